@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const AdminRollbackPath = "/rollback"
+
+var AdminNotLoopbackError = errors.New("admin api only listens on loopback addresses")
+
+// RollbackFunc routes every port back to the previous session and returns its name.
+type RollbackFunc func() (string, error)
+
+// NewAdminHandler serves the admin API. POST /rollback flips to the previous session.
+func NewAdminHandler(rollback RollbackFunc) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+AdminRollbackPath, func(w http.ResponseWriter, r *http.Request) {
+		session, err := rollback()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		fmt.Fprintln(w, session)
+	})
+
+	return mux
+}
+
+// AdminListenAddr returns the address the admin API listens on. The API is not authenticated,
+// so an address without a host listens on 127.0.0.1 and any host but a loopback one is refused.
+func AdminListenAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+
+	switch ip := net.ParseIP(host); {
+	case host == "":
+		host = "127.0.0.1"
+	case host == "localhost", ip != nil && ip.IsLoopback():
+	default:
+		return "", fmt.Errorf("%w: %s", AdminNotLoopbackError, addr)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// ServeAdmin runs the admin API on addr, which AdminListenAddr has to accept, until ctx is done.
+func ServeAdmin(ctx context.Context, addr string, handler http.Handler) error {
+	addr, err := AdminListenAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	context.AfterFunc(ctx, func() {
+		srv.Close()
+	})
+
+	log.Info().Str("addr", lis.Addr().String()).Msg("serving admin api")
+	if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// WatchRollbackKey reads lines from r and rolls back when one is "r" or "rollback".
+// It returns when r is exhausted, e.g. when stdin is not a terminal.
+func WatchRollbackKey(r io.Reader, rollback RollbackFunc) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		switch strings.TrimSpace(scanner.Text()) {
+		case "r", "rollback":
+			session, err := rollback()
+			if err != nil {
+				log.Error().Err(err).Msg("failed to roll back")
+				continue
+			}
+			log.Info().Str("session", session).Msg("rolled back")
+		}
+	}
+}
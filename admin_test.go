@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewAdminHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		err    error
+		code   int
+		body   string
+	}{
+		{name: "rolled back", method: http.MethodPost, path: AdminRollbackPath, code: http.StatusOK, body: "previous\n"},
+		{name: "nothing to roll back to", method: http.MethodPost, path: AdminRollbackPath, err: CommandWatchNoPreviousError, code: http.StatusConflict, body: CommandWatchNoPreviousError.Error() + "\n"},
+		{name: "get", method: http.MethodGet, path: AdminRollbackPath, code: http.StatusMethodNotAllowed},
+		{name: "unknown path", method: http.MethodPost, path: "/restart", code: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := NewAdminHandler(func() (string, error) {
+				called = true
+				if tt.err != nil {
+					return "", tt.err
+				}
+				return "previous", nil
+			})
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != tt.code {
+				t.Errorf("status = %d, want %d", rec.Code, tt.code)
+			}
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.body)
+			}
+			if want := tt.method == http.MethodPost && tt.path == AdminRollbackPath; called != want {
+				t.Errorf("rollback called = %v, want %v", called, want)
+			}
+		})
+	}
+}
+
+func TestAdminListenAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+		err  error
+	}{
+		{addr: "127.0.0.1:9900", want: "127.0.0.1:9900"},
+		{addr: ":9900", want: "127.0.0.1:9900"},
+		{addr: "localhost:9900", want: "localhost:9900"},
+		{addr: "[::1]:9900", want: "[::1]:9900"},
+		{addr: "0.0.0.0:9900", err: AdminNotLoopbackError},
+		{addr: "[::]:9900", err: AdminNotLoopbackError},
+		{addr: "192.168.0.10:9900", err: AdminNotLoopbackError},
+		{addr: "example.com:9900", err: AdminNotLoopbackError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			got, err := AdminListenAddr(tt.addr)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("AdminListenAddr() error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("AdminListenAddr() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchRollbackKey(t *testing.T) {
+	calls := 0
+	WatchRollbackKey(strings.NewReader("x\nr\n  rollback \nrestart\n"), func() (string, error) {
+		calls++
+		return "previous", nil
+	})
+
+	if calls != 2 {
+		t.Errorf("rollback called %d times, want 2", calls)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const DefaultCanaryInterval = 30 * time.Second
+
+var (
+	TcpReverseProxyCanaryInProgressError = errors.New("a canary is already in progress")
+	TcpReverseProxyNoCurrentError        = errors.New("no current destination to split traffic with")
+
+	CanaryDialError         = errors.New("failed to dial canary")
+	CanaryNotListeningError = errors.New("canary is not listening")
+	CanaryExitedError       = errors.New("canary runnable exited")
+	CanarySupersededError   = errors.New("canary superseded by a newer session")
+	CanaryRolledBackError   = errors.New("canary rolled back")
+)
+
+// StartCanary adds a destination that receives weight percent of new connections,
+// while the current destination keeps the rest. onDialError is called whenever
+// a connection to the canary cannot be dialed.
+func (trp *TcpReverseProxy) StartCanary(name, network, addr string, weight int, cleanup func(), onDialError func(error)) error {
+	destAddr, err := ResolveDestinationAddr(network, addr)
+	if err != nil {
+		return err
+	}
+
+	trp.destinationsLock.Lock()
+	defer trp.destinationsLock.Unlock()
+
+	if trp.canaryName != "" {
+		return TcpReverseProxyCanaryInProgressError
+	}
+
+	if trp.destinations[trp.currentLatest] == nil {
+		return TcpReverseProxyNoCurrentError
+	}
+
+	trp.destinations[name] = &Destination{
+		session:     name,
+		service:     trp.config.Name,
+		addr:        destAddr,
+		cleanup:     cleanup,
+		conns:       make(map[io.Closer]struct{}),
+		onDialError: onDialError,
+	}
+	trp.canaryName = name
+	trp.canaryWeight = weight
+
+	return nil
+}
+
+// SetCanaryWeight changes the percentage of new connections routed to the canary.
+func (trp *TcpReverseProxy) SetCanaryWeight(weight int) {
+	trp.destinationsLock.Lock()
+	trp.canaryWeight = weight
+	trp.destinationsLock.Unlock()
+}
+
+// PromoteCanary makes the canary the current destination and retires the
+// previous one the same way RenewDestination does.
+func (trp *TcpReverseProxy) PromoteCanary(name string) error {
+	trp.destinationsLock.Lock()
+	if trp.canaryName != name {
+		trp.destinationsLock.Unlock()
+		return TcpReverseProxyDestinationNotFoundError
+	}
+	latestName := trp.currentLatest
+	previous := trp.destinations[latestName]
+	dest := trp.destinations[name]
+	trp.currentLatest = name
+	trp.canaryName = ""
+	trp.destinationsLock.Unlock()
+
+	if trp.liveReload != nil {
+		go trp.notifyLiveReload(name, dest.addr)
+	}
+
+	if previous != nil {
+		trp.retireDestination(latestName, previous, trp.config.KeepPrevious)
+	}
+
+	return nil
+}
+
+// AbortCanary stops routing to the canary and retires it without keeping it.
+func (trp *TcpReverseProxy) AbortCanary(name string) error {
+	trp.destinationsLock.Lock()
+	if trp.canaryName != name {
+		trp.destinationsLock.Unlock()
+		return TcpReverseProxyDestinationNotFoundError
+	}
+	dest := trp.destinations[name]
+	trp.canaryName = ""
+	trp.destinationsLock.Unlock()
+
+	trp.retireDestination(name, dest, 0)
+
+	return nil
+}
+
+// pick returns the destination a new connection is routed to,
+// splitting between the canary and the current destination by weight.
+func (trp *TcpReverseProxy) pick() (string, *Destination) {
+	trp.destinationsLock.RLock()
+	defer trp.destinationsLock.RUnlock()
+
+	if trp.canaryName != "" && rand.IntN(100) < trp.canaryWeight {
+		return trp.canaryName, trp.destinations[trp.canaryName]
+	}
+
+	return trp.currentLatest, trp.destinations[trp.currentLatest]
+}
+
+// WaitListening dials every address until it accepts a connection, so that a canary without
+// readiness notification only gets traffic once its build has finished and it serves.
+// It gives up after timeout, when alive reports the session has exited or when ctx is done.
+func WaitListening(ctx context.Context, addrs map[string]net.Addr, timeout time.Duration, alive func() bool) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for name, addr := range addrs {
+		for {
+			conn, err := net.DialTimeout(addr.Network(), addr.String(), time.Second)
+			if err == nil {
+				conn.Close()
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-deadline.C:
+				return fmt.Errorf("%w on port %s after %s: %w", CanaryNotListeningError, name, timeout, err)
+			case <-ticker.C:
+				if !alive() {
+					return CanaryExitedError
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Canary shifts the traffic of every proxy to a new session step by step.
+// Each step is the percentage of new connections routed to the session,
+// held for the interval before moving on. After the last step the session is promoted.
+type Canary struct {
+	session  string
+	proxies  map[string]*TcpReverseProxy
+	steps    []int
+	interval time.Duration
+	done     chan struct{}
+	once     sync.Once
+	err      error
+}
+
+func NewCanary(session string, proxies map[string]*TcpReverseProxy, steps []int, interval time.Duration) *Canary {
+	if interval <= 0 {
+		interval = DefaultCanaryInterval
+	}
+
+	return &Canary{
+		session:  session,
+		proxies:  proxies,
+		steps:    steps,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start adds the session as canary on every proxy with the weight of the first step.
+func (c *Canary) Start(addrs map[string]net.Addr, cleanup func()) error {
+	for name, rp := range c.proxies {
+		addr := addrs[name]
+		if err := rp.StartCanary(c.session, addr.Network(), addr.String(), c.steps[0], cleanup, func(err error) {
+			c.Abort(fmt.Errorf("%w on port %s: %w", CanaryDialError, name, err))
+		}); err != nil {
+			return fmt.Errorf("failed to start canary on port %s: %w", name, err)
+		}
+	}
+
+	log.Info().Str("session", c.session).Int("weight", c.steps[0]).Msg("started canary")
+
+	return nil
+}
+
+// Run ramps the canary through its steps and promotes it after the last one.
+// It aborts the canary when alive reports the session has exited or ctx is done,
+// and returns the reason when the canary was aborted.
+func (c *Canary) Run(ctx context.Context, alive func() bool) error {
+	step := time.NewTimer(c.interval)
+	defer step.Stop()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for i := 1; ; {
+		select {
+		case <-c.done:
+			return c.err
+		case <-ctx.Done():
+			c.Abort(ctx.Err())
+		case <-ticker.C:
+			if !alive() {
+				c.Abort(CanaryExitedError)
+			}
+		case <-step.C:
+			if i == len(c.steps) {
+				c.promote()
+				continue
+			}
+
+			for _, rp := range c.proxies {
+				rp.SetCanaryWeight(c.steps[i])
+			}
+			log.Info().Str("session", c.session).Int("weight", c.steps[i]).Msg("increased canary weight")
+			i++
+			step.Reset(c.interval)
+		}
+	}
+}
+
+// Abort routes all new connections back to the previous session and retires the canary.
+// It does nothing once the canary was promoted or aborted.
+func (c *Canary) Abort(err error) {
+	c.once.Do(func() {
+		c.err = err
+		for _, rp := range c.proxies {
+			rp.AbortCanary(c.session)
+		}
+		log.Warn().Err(err).Str("session", c.session).Msg("aborted canary")
+		close(c.done)
+	})
+}
+
+func (c *Canary) promote() {
+	c.once.Do(func() {
+		for _, rp := range c.proxies {
+			rp.PromoteCanary(c.session)
+		}
+		log.Info().Str("session", c.session).Msg("promoted canary")
+		close(c.done)
+	})
+}
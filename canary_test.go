@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCanaryRun(t *testing.T) {
+	const interval = 200 * time.Millisecond
+
+	tests := []struct {
+		name string
+		// act aborts the canary and returns what alive reports from then on, nil lets it ramp
+		act func(c *Canary, cancel context.CancelFunc) bool
+		err error
+		// current is the destination new connections go to once Run returned
+		current string
+	}{
+		{
+			name:    "promoted after the last step",
+			current: "new",
+		},
+		{
+			name:    "exited",
+			act:     func(c *Canary, cancel context.CancelFunc) bool { return false },
+			err:     CanaryExitedError,
+			current: "old",
+		},
+		{
+			name: "rolled back",
+			act: func(c *Canary, cancel context.CancelFunc) bool {
+				c.Abort(CanaryRolledBackError)
+				return true
+			},
+			err:     CanaryRolledBackError,
+			current: "old",
+		},
+		{
+			name: "canceled",
+			act: func(c *Canary, cancel context.CancelFunc) bool {
+				cancel()
+				return true
+			},
+			err:     context.Canceled,
+			current: "old",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := NewTcpReverseProxy("127.0.0.1:0")
+			if err := rp.RenewDestination("old", "tcp", "127.0.0.1:10001", nil); err != nil {
+				t.Fatalf("RenewDestination() error = %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			c := NewCanary("new", map[string]*TcpReverseProxy{"api": rp}, []int{10, 50}, interval)
+			if err := c.Start(map[string]net.Addr{"api": &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 10002}}, nil); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			if name, weight := canaryState(rp); name != "new" || weight != 10 {
+				t.Fatalf("canary = %s at %d%%, want new at 10%%", name, weight)
+			}
+
+			alive := true
+			if tt.act == nil {
+				// the second step starts after one interval
+				time.AfterFunc(interval+interval/2, func() {
+					if name, weight := canaryState(rp); name != "new" || weight != 50 {
+						t.Errorf("canary = %s at %d%% after one interval, want new at 50%%", name, weight)
+					}
+				})
+			} else {
+				alive = tt.act(c, cancel)
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				done <- c.Run(ctx, func() bool { return alive })
+			}()
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, tt.err) {
+					t.Errorf("Run() error = %v, want %v", err, tt.err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Run() did not return")
+			}
+
+			if name, _ := rp.current(); name != tt.current {
+				t.Errorf("current = %s, want %s", name, tt.current)
+			}
+			if name, _ := canaryState(rp); name != "" {
+				t.Errorf("canary = %s after Run(), want none", name)
+			}
+		})
+	}
+}
+
+func TestCanaryDialError(t *testing.T) {
+	backend := startTestBackend(t, echo)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	closedAddr := closed.Addr()
+	closed.Close()
+
+	port, err := GetFreeTcpPort()
+	if err != nil {
+		t.Fatalf("GetFreeTcpPort() error = %v", err)
+	}
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rp := NewTcpReverseProxy(addr)
+	if err := rp.RenewDestination("session", backend.Network(), backend.String(), nil); err != nil {
+		t.Fatalf("RenewDestination() error = %v", err)
+	}
+	go rp.Start(ctx)
+
+	c := NewCanary("new", map[string]*TcpReverseProxy{"api": rp}, []int{100}, time.Minute)
+	if err := c.Start(map[string]net.Addr{"api": closedAddr}, nil); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// every connection goes to the canary, which nothing listens for
+	conn, err := dialWhenListening("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	conn.Close()
+
+	if err := c.Run(ctx, func() bool { return true }); !errors.Is(err, CanaryDialError) {
+		t.Errorf("Run() error = %v, want %v", err, CanaryDialError)
+	}
+	if name, _ := rp.current(); name != "session" {
+		t.Errorf("current = %s, want session", name)
+	}
+}
+
+func TestWaitListening(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	closed.Close()
+
+	tests := []struct {
+		name  string
+		addr  net.Addr
+		alive bool
+		err   error
+	}{
+		{name: "listening", addr: l.Addr(), alive: true},
+		{name: "not listening", addr: closed.Addr(), alive: true, err: CanaryNotListeningError},
+		{name: "exited", addr: closed.Addr(), alive: false, err: CanaryExitedError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WaitListening(context.Background(), map[string]net.Addr{"api": tt.addr}, 500*time.Millisecond, func() bool { return tt.alive })
+			if !errors.Is(err, tt.err) {
+				t.Errorf("WaitListening() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func canaryState(rp *TcpReverseProxy) (string, int) {
+	rp.destinationsLock.RLock()
+	defer rp.destinationsLock.RUnlock()
+	return rp.canaryName, rp.canaryWeight
+}
@@ -1,3 +1,7 @@
 package main
 
+import "errors"
+
+var CommandUnknownError = errors.New("unknown command")
+
 type CommandFunc func(args []string) error
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strings"
+)
+
+var CommandTooManyArgumentsError = errors.New("too many arguments")
+
+// stringsFlag collects a flag given several times or once with comma separated values.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*f = append(*f, v)
+		}
+	}
+
+	return nil
+}
+
+// parseInterspersed parses flags given before, between or after the positional arguments,
+// which it returns in order. Everything after -- is positional.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string(nil)
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		rest := fs.Args()
+		if parsed := len(args) - len(rest); parsed > 0 && args[parsed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+
+		args = rest
+		if len(args) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// listFlag collects a flag given several times, keeping commas in the values.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// configFlags are the flags of the commands that read a config.
+type configFlags struct {
+	profiles  stringsFlag
+	overrides listFlag
+	logLevel  string
+	root      string
+}
+
+func (cf *configFlags) register(fs *flag.FlagSet) {
+	fs.Var(&cf.profiles, "profile", "profiles to merge over the config, comma separated or repeated")
+	fs.Var(&cf.overrides, "set", "path=value overriding a field of the config, like scripts.run=./app, repeated")
+	fs.StringVar(&cf.logLevel, "log-level", "", "overrides log_level of the config")
+	fs.StringVar(&cf.root, "root", "", "overrides root of the config")
+}
+
+// options returns the options to load the config with, the shorthand flags before --set.
+func (cf *configFlags) options() []func(*ConfigLoadConfig) {
+	overrides := []string(nil)
+	if cf.logLevel != "" {
+		overrides = append(overrides, "log_level="+cf.logLevel)
+	}
+	if cf.root != "" {
+		overrides = append(overrides, "root="+cf.root)
+	}
+	overrides = append(overrides, cf.overrides...)
+
+	return []func(*ConfigLoadConfig){WithProfiles(cf.profiles...), WithOverrides(overrides...)}
+}
+
+// configFile returns the config file given in args, or finds one from the working directory.
+// Relative paths in a config are resolved against its directory, so revolver can run a config
+// found above the working directory without moving there.
+func configFile(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+
+	return FindConfig(".")
+}
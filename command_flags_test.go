@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		positional []string
+		profiles   []string
+	}{
+		{name: "flags first", args: []string{"--profile", "debug", "dev.yaml"}, positional: []string{"dev.yaml"}, profiles: []string{"debug"}},
+		{name: "flags last", args: []string{"dev.yaml", "--profile", "debug"}, positional: []string{"dev.yaml"}, profiles: []string{"debug"}},
+		{name: "between", args: []string{"a", "--profile=x", "b", "--profile", "y"}, positional: []string{"a", "b"}, profiles: []string{"x", "y"}},
+		{name: "double dash", args: []string{"--profile", "debug", "--", "--profile", "-x"}, positional: []string{"--profile", "-x"}, profiles: []string{"debug"}},
+		{name: "double dash after positional", args: []string{"dev.yaml", "--", "--set"}, positional: []string{"dev.yaml", "--set"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			flags := configFlags{}
+			flags.register(fs)
+
+			got, err := parseInterspersed(fs, tt.args)
+			if err != nil {
+				t.Fatalf("parseInterspersed() error = %v", err)
+			}
+			if !slices.Equal(got, tt.positional) {
+				t.Errorf("parseInterspersed() = %q, want %q", got, tt.positional)
+			}
+			if !slices.Equal(flags.profiles, tt.profiles) {
+				t.Errorf("profiles = %q, want %q", flags.profiles, tt.profiles)
+			}
+		})
+	}
+}
@@ -2,44 +2,107 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
-	"gopkg.in/yaml.v3"
+	"github.com/rs/zerolog/log"
 )
 
 const CommandInit = "init"
 
-var CommandInitNotFoundFileNameError = errors.New("not found file name")
+// DefaultConfigFile is the config init writes without a filename, the first one FindConfig looks for.
+const DefaultConfigFile = "revolver.yaml"
+
+var CommandInitFileExistsError = errors.New("config file already exists")
 
 func CommandInitFunc(args []string) error {
-	if len(args) != 1 {
-		fmt.Printf("Usage: %s %s <filename>\n", os.Args[0], CommandInit)
-		return CommandInitNotFoundFileNameError
+	fs := flag.NewFlagSet(CommandInit, flag.ContinueOnError)
+	format := fs.String("format", "", "yaml, json or toml, detected from the file extension when empty")
+	force := fs.Bool("force", false, "overwrite an existing config file")
+	yes := fs.Bool("yes", false, "take the proposed values without asking")
+
+	args, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) > 1 {
+		fmt.Printf("Usage: %s %s [filename] [--format yaml|json|toml] [--force] [--yes]\n", os.Args[0], CommandInit)
+		return CommandTooManyArgumentsError
 	}
 
-	filename := args[0]
+	filename := DefaultConfigFile
+	if len(args) == 1 {
+		filename = args[0]
+	}
+
+	configFormat := ConfigFormatOf(filename)
+	if *format != "" {
+		configFormat = ConfigFormat(*format)
+	}
+	switch configFormat {
+	case ConfigFormatYaml, ConfigFormatJson, ConfigFormatToml:
+	default:
+		return fmt.Errorf("%w: %s", ConfigUnknownFormatError, configFormat)
+	}
+
+	// checked before asking anything, creating the file checks again
+	if _, err := os.Stat(filename); err == nil && !*force {
+		return fmt.Errorf("%w: %s, use --force to overwrite it", CommandInitFileExistsError, filename)
+	}
+
+	configDir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+
+	cfg := initConfig(configDir, newPrompter(os.Stdin, os.Stdout, !*yes && isTerminal(os.Stdin)))
+
 	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
 		return err
 	}
 
-	file, err := os.Create(filename)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !*force {
+		flags |= os.O_EXCL
+	}
+	file, err := os.OpenFile(filename, flags, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%w: %s, use --force to overwrite it", CommandInitFileExistsError, filename)
+	}
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
+	if configFormat == ConfigFormatYaml {
+		// lets editors with the yaml language server complete and check the config
+		if _, err := fmt.Fprintf(file, "# yaml-language-server: $schema=%s\n", ConfigSchemaURL); err != nil {
+			return err
+		}
+	}
+
+	if err := EncodeConfig(file, cfg, configFormat); err != nil {
+		return err
+	}
+
+	log.Info().Str("filename", filename).Msg("created config")
+
+	return nil
+}
+
+// initConfig proposes a config for the go module containing configDir, asking p to confirm
+// or change the proposals. Without a module it falls back to a config for the directory itself.
+func initConfig(configDir string, p *prompter) RevolverConfig {
 	cfg := RevolverConfig{
 		LogLevel:                LogLevelInfo,
 		ProjectRootFolder:       ".",
-		ExecutablePackageFolder: "cmd/revolver",
-		Ports: []RevolverPortConfig{
-			{
-				Port: 8080,
-				Name: "http",
-				Env:  "HTTP_PORT",
-			},
-		},
+		ExecutablePackageFolder: ".",
 		Scripts: RevolverScriptConfig{
 			Preload: "go build -o app .",
 			Run:     "./app",
@@ -48,12 +111,68 @@ func CommandInitFunc(args []string) error {
 		ObservingExts: []string{".go", ".mod", ".sum"},
 	}
 
-	encoder := yaml.NewEncoder(file)
-	encoder.SetIndent(2)
-	if err := encoder.Encode(cfg); err != nil {
-		return err
+	project, err := InspectGoProject(configDir)
+	if project.ModuleDir == "" {
+		log.Warn().Err(err).Str("dir", configDir).Msg("no go module found, proposing a config for the directory")
+	} else if err != nil {
+		log.Warn().Err(err).Str("module", project.ModulePath).Msg("failed to inspect the go module")
+	} else {
+		log.Info().Str("module", project.ModulePath).Strs("main_packages", project.MainPackages).Strs("port_envs", project.PortEnvs).Msg("inspected go module")
 	}
-	encoder.Close()
 
-	return nil
+	// paths in the config are relative to where revolver runs, next to the config
+	rel := func(path string) string {
+		if r, err := filepath.Rel(configDir, path); err == nil {
+			return filepath.ToSlash(r)
+		}
+		return path
+	}
+
+	if project.ModuleDir != "" {
+		cfg.ProjectRootFolder = rel(project.ModuleDir)
+	}
+
+	execs := make([]string, len(project.MainPackages))
+	for i, dir := range project.MainPackages {
+		execs[i] = rel(dir)
+	}
+	if len(execs) == 0 {
+		log.Warn().Msg("no main package found, exec is the config directory")
+		execs = []string{"."}
+	}
+	cfg.ExecutablePackageFolder = p.choose("Which main package should revolver run?", execs)
+
+	binary := filepath.Base(cfg.ExecutablePackageFolder)
+	if binary == "." || binary == ".." || binary == string(filepath.Separator) {
+		binary = "app"
+	}
+	cfg.Scripts = RevolverScriptConfig{
+		Preload: p.choose("How should it be built?", []string{
+			"go build -o " + binary + " .",
+			"go build -race -o " + binary + " .",
+		}),
+		Run:     "./" + binary,
+		CleanUp: "rm " + binary,
+	}
+
+	envs := project.PortEnvs
+	if len(envs) == 0 {
+		log.Warn().Msg("no port variable found in the code, the application should listen on PORT")
+		envs = []string{"PORT"}
+	}
+	for i, env := range envs {
+		def := 8080 + i
+		port, err := strconv.Atoi(p.ask(fmt.Sprintf("Port for clients, proxied to the application on %s", env), strconv.Itoa(def)))
+		if err != nil {
+			log.Warn().Err(err).Int("port", def).Msg("invalid port, using the proposed one")
+			port = def
+		}
+		name := portName(env)
+		if slices.ContainsFunc(cfg.Ports, func(p RevolverPortConfig) bool { return p.Name == name }) {
+			name = strings.ToLower(env)
+		}
+		cfg.Ports = append(cfg.Ports, RevolverPortConfig{Port: port, Name: name, Env: env})
+	}
+
+	return cfg
 }
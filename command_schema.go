@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const CommandSchema = "schema"
+
+func CommandSchemaFunc(args []string) error {
+	if len(args) > 1 {
+		fmt.Printf("Usage: %s %s [filename]\n", os.Args[0], CommandSchema)
+		return CommandTooManyArgumentsError
+	}
+
+	if len(args) == 0 {
+		return WriteConfigSchema(os.Stdout)
+	}
+
+	filename := args[0]
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteConfigSchema(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const CommandValidate = "validate"
+
+var CommandValidateInvalidError = errors.New("config is invalid")
+
+func CommandValidateFunc(args []string) error {
+	fs := flag.NewFlagSet(CommandValidate, flag.ContinueOnError)
+	flags := configFlags{}
+	flags.register(fs)
+
+	args, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) > 1 {
+		fmt.Printf("Usage: %s %s [filename] [--profile name] [--set path=value]\n", os.Args[0], CommandValidate)
+		return CommandTooManyArgumentsError
+	}
+
+	filename, err := configFile(args)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ReadConfig(filename, flags.options()...); err != nil {
+		PrintConfigErrors(os.Stderr, filename, err)
+		if IsConfigFatal(err) {
+			return CommandValidateInvalidError
+		}
+	}
+
+	fmt.Printf("%s is valid\n", filename)
+
+	return nil
+}
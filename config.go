@@ -1,22 +1,135 @@
 package main
 
+import (
+	"strconv"
+	"time"
+)
+
+type PortMode string
+
+const (
+	PortModeTcp  PortMode = "tcp"
+	PortModeHttp PortMode = "http"
+	PortModeSni  PortMode = "sni"
+)
+
+type BackendNetwork string
+
+const (
+	BackendNetworkTcp  BackendNetwork = "tcp"
+	BackendNetworkUnix BackendNetwork = "unix"
+)
+
+type ConnLimitPolicy string
+
+const (
+	// ConnLimitPolicyWait stops accepting while the limit is reached,
+	// so new clients queue in the kernel backlog.
+	ConnLimitPolicyWait ConnLimitPolicy = "wait"
+	// ConnLimitPolicyReject accepts and immediately closes connections over the limit.
+	ConnLimitPolicyReject ConnLimitPolicy = "reject"
+)
+
+type RevolverTlsConfig struct {
+	Cert  string   `yaml:"cert,omitempty"`
+	Key   string   `yaml:"key,omitempty"`
+	Auto  bool     `yaml:"auto,omitempty"`
+	Dir   string   `yaml:"dir,omitempty"`
+	Hosts []string `yaml:"hosts,omitempty"`
+}
+
 type RevolverPortConfig struct {
-	Port int    `yaml:"port"`
-	Name string `yaml:"name"`
-	Env  string `yaml:"env"`
+	Port       int                `yaml:"port"`
+	Name       string             `yaml:"name"`
+	Env        string             `yaml:"env"`
+	Socket     string             `yaml:"socket,omitempty"`
+	Backend    BackendNetwork     `yaml:"backend,omitempty"`
+	Inherit    bool               `yaml:"inherit,omitempty"`
+	Mode       PortMode           `yaml:"mode,omitempty"`
+	LiveReload bool               `yaml:"livereload,omitempty"`
+	Tls        *RevolverTlsConfig `yaml:"tls,omitempty"`
+	// Routes maps server names of an sni port to the ports they are passed through to.
+	// "*.example.localhost" matches a single label and "*" every other name.
+	Routes map[string]string `yaml:"routes,omitempty"`
+}
+
+// ListenAddr returns the network and address of the front listener.
+// A socket path takes precedence over the port.
+func (c RevolverPortConfig) ListenAddr() (string, string) {
+	if c.Socket != "" {
+		return "unix", c.Socket
+	}
+
+	return "tcp", "0.0.0.0:" + strconv.FormatInt(int64(c.Port), 10)
+}
+
+// HasBackend reports whether the port is served by the application itself.
+// SNI ports only route to other ports and get no backend address of their own.
+func (c RevolverPortConfig) HasBackend() bool {
+	return c.Mode != PortModeSni
 }
 
 type RevolverScriptConfig struct {
-	Preload string `yaml:"preload"`
-	Run     string `yaml:"run"`
-	CleanUp string `yaml:"cleanup"`
+	Preload     string        `yaml:"preload"`
+	Run         string        `yaml:"run"`
+	CleanUp     string        `yaml:"cleanup"`
+	StopTimeout time.Duration `yaml:"stop_timeout,omitempty"`
+}
+
+type RevolverReadyConfig struct {
+	Notify  bool          `yaml:"notify,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// WaitTimeout is how long a new session may take to become ready.
+func (c RevolverReadyConfig) WaitTimeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultReadyTimeout
+	}
+
+	return c.Timeout
+}
+
+// RevolverRollbackConfig keeps the previous runnable warm after a swap so that
+// a rollback can route back to it without rebuilding. A new runnable exiting
+// within the window after the swap is rolled back automatically.
+type RevolverRollbackConfig struct {
+	Keep   time.Duration `yaml:"keep,omitempty"`
+	Admin  string        `yaml:"admin,omitempty"`
+	Window time.Duration `yaml:"window,omitempty"`
+}
+
+// RevolverCanaryConfig splits new connections between the previous and the new
+// runnable. Each step is the percentage routed to the new one, held for the interval.
+type RevolverCanaryConfig struct {
+	Steps    []int         `yaml:"steps,omitempty"`
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// RevolverLimitsConfig applies to the client connections of every port together.
+type RevolverLimitsConfig struct {
+	MaxConnections int             `yaml:"max_connections,omitempty"`
+	Policy         ConnLimitPolicy `yaml:"policy,omitempty"`
+	IdleTimeout    time.Duration   `yaml:"idle_timeout,omitempty"`
 }
 
 type RevolverConfig struct {
-	LogLevel                LogLevel             `yaml:"log_level"`
-	ProjectRootFolder       string               `yaml:"root"`
-	ExecutablePackageFolder string               `yaml:"exec"`
-	Ports                   []RevolverPortConfig `yaml:"ports"`
-	Scripts                 RevolverScriptConfig `yaml:"scripts"`
-	ObservingExts           []string             `yaml:"exts"`
+	LogLevel                LogLevel               `yaml:"log_level"`
+	ProjectRootFolder       string                 `yaml:"root"`
+	ExecutablePackageFolder string                 `yaml:"exec"`
+	Ports                   []RevolverPortConfig   `yaml:"ports"`
+	Scripts                 RevolverScriptConfig   `yaml:"scripts"`
+	ObservingExts           []string               `yaml:"exts"`
+	EnvFiles                []string               `yaml:"env_file,omitempty"`
+	Ready                   RevolverReadyConfig    `yaml:"ready,omitempty"`
+	DrainTimeout            time.Duration          `yaml:"drain_timeout,omitempty"`
+	Rollback                RevolverRollbackConfig `yaml:"rollback,omitempty"`
+	Canary                  RevolverCanaryConfig   `yaml:"canary,omitempty"`
+	Limits                  RevolverLimitsConfig   `yaml:"limits,omitempty"`
+	// Extends names a config file this one is merged over, relative to this file
+	Extends string `yaml:"extends,omitempty"`
+	// Profiles are overlays merged over the config when selected with --profile
+	Profiles map[string]RevolverConfig `yaml:"profiles,omitempty"`
+	// Files are the config files the config was read from, the extended ones first
+	Files []string `yaml:"-"`
 }
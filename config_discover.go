@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var ConfigNotFoundError = errors.New("no config file found")
+
+// ConfigFileNames are the config files FindConfig looks for in every directory, in order.
+var ConfigFileNames = []string{
+	"revolver.yaml",
+	"revolver.yml",
+	"revolver.json",
+	"revolver.toml",
+	".revolver.yaml",
+	".revolver.yml",
+	".revolver.json",
+	".revolver.toml",
+	"dev.yaml",
+}
+
+// FindConfig looks for a config file in dir and then in every directory above it.
+func FindConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	for {
+		for _, name := range ConfigFileNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, nil
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("%w: looked for %v", ConfigNotFoundError, ConfigFileNames)
+		}
+		dir = parent
+	}
+}
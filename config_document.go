@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ConfigExtendsCycleError   = errors.New("config extends itself")
+	ConfigUnknownProfileError = errors.New("unknown profile")
+)
+
+// ConfigDocument is the yaml tree a config was decoded from, after merging the files it
+// extends and the selected profiles. Nodes that came from an extended file remember it,
+// so errors can point into that file.
+type ConfigDocument struct {
+	Root *yaml.Node
+	// Files are the absolute paths of every file read, the extended ones first
+	Files []string
+	// Dir is the directory of the main config file
+	Dir   string
+	files map[*yaml.Node]string
+}
+
+func newConfigDocument(filename string) *ConfigDocument {
+	return &ConfigDocument{Dir: filepath.Dir(filename), files: map[*yaml.Node]string{}}
+}
+
+// configPathFields are the fields that hold paths, "*" standing for every item of a list.
+var configPathFields = [][]string{
+	{"root"},
+	{"exec"},
+	{"env_file", "*"},
+	{"ports", "*", "socket"},
+	{"ports", "*", "tls", "cert"},
+	{"ports", "*", "tls", "key"},
+	{"ports", "*", "tls", "dir"},
+}
+
+// resolvePaths makes the relative paths in root relative to the directory of the file they
+// were written in instead of the working directory. Paths given with --set stay relative to
+// the working directory.
+func (d *ConfigDocument) resolvePaths(root *yaml.Node) {
+	for _, field := range configPathFields {
+		for _, node := range nodesAt(root, field) {
+			if node.Kind != yaml.ScalarNode || node.Value == "" || filepath.IsAbs(node.Value) {
+				continue
+			}
+
+			dir := d.Dir
+			switch file := d.files[node]; file {
+			case "":
+			case ConfigOverrideFile:
+				continue
+			default:
+				dir = filepath.Dir(file)
+			}
+			node.Value = filepath.Join(dir, node.Value)
+		}
+	}
+}
+
+// nodesAt returns the nodes along path, where "*" matches every item of a sequence.
+func nodesAt(node *yaml.Node, path []string) []*yaml.Node {
+	if node == nil {
+		return nil
+	}
+	if len(path) == 0 {
+		return []*yaml.Node{node}
+	}
+
+	if path[0] != "*" {
+		return nodesAt(mappingValue(node, path[0]), path[1:])
+	}
+
+	if node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	nodes := []*yaml.Node(nil)
+	for _, item := range node.Content {
+		nodes = append(nodes, nodesAt(item, path[1:])...)
+	}
+
+	return nodes
+}
+
+// position returns the file, line and column of a node. The file is empty for the main config file.
+func (d *ConfigDocument) position(node *yaml.Node) (string, int, int) {
+	return d.files[node], node.Line, node.Column
+}
+
+// load reads a config file and the files it extends, merged into one mapping.
+// name is how errors refer to the file, empty for the main config file.
+// Problems in the content are collected in the returned ConfigErrors, err is only set
+// when the file itself cannot be read.
+func (d *ConfigDocument) load(filename, name string, chain []string) (*yaml.Node, ConfigErrors, error) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve file: %w", err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	inFile := func(errs ...*ConfigError) ConfigErrors {
+		for _, e := range errs {
+			e.File = name
+		}
+		return errs
+	}
+
+	root, parseErr := parseConfig(ConfigFormatOf(filename), data)
+	if parseErr != nil {
+		return nil, inFile(parseErr), nil
+	}
+
+	if err := InterpolateConfig(root, os.LookupEnv); err != nil {
+		errs := ConfigErrors{}
+		errors.As(err, &errs)
+		return nil, inFile(errs...), nil
+	}
+
+	// every file has to be a valid config on its own, which also checks the profiles it defines
+	errs := inFile(decodeConfigNode(root, &RevolverConfig{})...)
+
+	if name != "" {
+		d.mark(root, name)
+	}
+
+	if extends := mappingValue(root, "extends"); extends != nil && extends.Value != "" {
+		base := extends.Value
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(filepath.Dir(filename), base)
+		}
+
+		basePath, _ := filepath.Abs(base)
+		chain = append(chain, path)
+		if slices.Contains(chain, basePath) {
+			errs = append(errs, inFile(&ConfigError{Line: extends.Line, Column: extends.Column, Err: fmt.Errorf("%w: %s", ConfigExtendsCycleError, extends.Value)})...)
+		} else if baseRoot, baseErrs, err := d.load(base, base, chain); err != nil {
+			errs = append(errs, inFile(&ConfigError{Line: extends.Line, Column: extends.Column, Err: err})...)
+		} else {
+			errs = append(errs, baseErrs...)
+			if baseRoot != nil {
+				root = d.merge(baseRoot, root)
+			}
+		}
+	}
+
+	d.Files = append(d.Files, path)
+
+	return root, errs, nil
+}
+
+// mark remembers the file of a node and everything below it.
+func (d *ConfigDocument) mark(node *yaml.Node, name string) {
+	d.files[node] = name
+	for _, child := range node.Content {
+		d.mark(child, name)
+	}
+}
+
+// merge deep merges overlay over base. Mappings are merged key by key, anything else in
+// overlay replaces what base has, lists included. Neither node is modified.
+func (d *ConfigDocument) merge(base, overlay *yaml.Node) *yaml.Node {
+	if base == nil || base.Kind != yaml.MappingNode || overlay.Kind != yaml.MappingNode {
+		return overlay
+	}
+
+	merged := *overlay
+	merged.Content = slices.Clone(base.Content)
+	d.files[&merged] = d.files[overlay]
+
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		j := mappingIndex(&merged, key.Value)
+		if j < 0 {
+			merged.Content = append(merged.Content, key, value)
+			continue
+		}
+		merged.Content[j], merged.Content[j+1] = key, d.merge(merged.Content[j+1], value)
+	}
+
+	return &merged
+}
+
+// applyProfiles merges the named profiles over root in order and drops the keys that only
+// describe how the config is put together.
+func (d *ConfigDocument) applyProfiles(root *yaml.Node, profiles []string) (*yaml.Node, ConfigErrors) {
+	errs := ConfigErrors{}
+	defined := mappingValue(root, "profiles")
+	for _, profile := range profiles {
+		overlay := mappingValue(defined, profile)
+		if overlay == nil {
+			errs = append(errs, &ConfigError{Err: fmt.Errorf("%w: %s", ConfigUnknownProfileError, profile)})
+			continue
+		}
+		root = d.merge(root, overlay)
+	}
+
+	stripped := *root
+	stripped.Content = nil
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if key := root.Content[i].Value; key == "extends" || key == "profiles" {
+			continue
+		}
+		stripped.Content = append(stripped.Content, root.Content[i], root.Content[i+1])
+	}
+	d.files[&stripped] = d.files[root]
+
+	return &stripped, errs
+}
+
+func mappingIndex(node *yaml.Node, key string) int {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return -1
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if i := mappingIndex(node, key); i >= 0 {
+		return node.Content[i+1]
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	return dir
+}
+
+func TestLoadConfigExtendsAndProfiles(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base/base.yaml": `log_level: info
+scripts:
+  preload: go build -o app .
+  run: ./app
+  cleanup: rm app
+exts: [.go]
+profiles:
+  race:
+    scripts:
+      preload: go build -race -o app .
+`,
+		"dev.yaml": `extends: base/base.yaml
+scripts:
+  run: ./app --dev
+exts: [.go, .tmpl]
+profiles:
+  debug:
+    log_level: debug
+`,
+	})
+
+	cfg, _, err := LoadConfig(filepath.Join(dir, "dev.yaml"), WithProfiles("race", "debug"))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	want := RevolverScriptConfig{Preload: "go build -race -o app .", Run: "./app --dev", CleanUp: "rm app"}
+	if cfg.Scripts != want {
+		t.Errorf("scripts = %+v, want %+v", cfg.Scripts, want)
+	}
+	if cfg.LogLevel != LogLevelDebug {
+		t.Errorf("log level = %s, want %s", cfg.LogLevel, LogLevelDebug)
+	}
+	// lists are replaced, not merged
+	if !slices.Equal(cfg.ObservingExts, []string{".go", ".tmpl"}) {
+		t.Errorf("exts = %v, want [.go .tmpl]", cfg.ObservingExts)
+	}
+	if cfg.Extends != "" || cfg.Profiles != nil {
+		t.Errorf("extends = %q, profiles = %v, want both dropped", cfg.Extends, cfg.Profiles)
+	}
+	if len(cfg.Files) != 2 || filepath.Base(cfg.Files[0]) != "base.yaml" || filepath.Base(cfg.Files[1]) != "dev.yaml" {
+		t.Errorf("files = %v, want base.yaml then dev.yaml", cfg.Files)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.yaml": "log_level: info\nprofiles:\n  debug:\n    colour: red\n",
+		"dev.yaml":  "extends: base.yaml\nexts: [.go]\n",
+		"a.yaml":    "extends: b.yaml\n",
+		"b.yaml":    "extends: a.yaml\n",
+	})
+
+	_, _, err := LoadConfig(filepath.Join(dir, "dev.yaml"), WithProfiles("missing"))
+	errs := ConfigErrors{}
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("LoadConfig() error = %v, want 2 ConfigErrors", err)
+	}
+	if !errors.Is(errs[0], ConfigUnknownFieldError) || filepath.Base(errs[0].File) != "base.yaml" || errs[0].Line != 4 {
+		t.Errorf("error = %v in %q, want the unknown field at base.yaml:4", errs[0], errs[0].File)
+	}
+	if !errors.Is(errs[1], ConfigUnknownProfileError) {
+		t.Errorf("error = %v, want %v", errs[1], ConfigUnknownProfileError)
+	}
+
+	_, _, err = LoadConfig(filepath.Join(dir, "a.yaml"))
+	if !errors.Is(err, ConfigExtendsCycleError) {
+		t.Errorf("LoadConfig() error = %v, want %v", err, ConfigExtendsCycleError)
+	}
+}
+
+func TestLoadConfigInterpolation(t *testing.T) {
+	t.Setenv("REVOLVER_TEST_PORT", "8080")
+	dir := writeConfigFiles(t, map[string]string{
+		"base/base.toml": `env_file = [".env"]
+
+[[ports]]
+name = "api"
+port = "${REVOLVER_TEST_PORT}"
+env = "PORT"
+`,
+		"dev.yaml": `# ${NOT A VARIABLE}
+extends: base/base.toml
+env_file: [.env, "${REVOLVER_TEST_MISSING:-.env.local}"]
+`,
+	})
+
+	cfg, _, err := LoadConfig(filepath.Join(dir, "dev.yaml"))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if len(cfg.Ports) != 1 || cfg.Ports[0].Port != 8080 {
+		t.Errorf("ports = %+v, want api on 8080", cfg.Ports)
+	}
+	if want := []string{filepath.Join(dir, ".env"), filepath.Join(dir, ".env.local")}; !slices.Equal(cfg.EnvFiles, want) {
+		t.Errorf("env_file = %v, want %v", cfg.EnvFiles, want)
+	}
+
+	cfg, _, err = LoadConfig(filepath.Join(dir, "base", "base.toml"))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if want := []string{filepath.Join(dir, "base", ".env")}; !slices.Equal(cfg.EnvFiles, want) {
+		t.Errorf("env_file = %v, want %v", cfg.EnvFiles, want)
+	}
+}
+
+func TestLoadConfigExtendsPaths(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base/base.yaml": `root: ..
+exec: cmd/api
+env_file: [.env]
+ports:
+  - name: api
+    port: 8443
+    env: PORT
+    tls:
+      cert: certs/cert.pem
+      key: /etc/revolver/key.pem
+profiles:
+  local:
+    env_file: [.env.local]
+`,
+		"dev.yaml": `extends: base/base.yaml
+exec: ./cmd/dev
+`,
+	})
+
+	cfg, _, err := LoadConfig(filepath.Join(dir, "dev.yaml"), WithProfiles("local"), WithOverrides("ports.0.socket=run/api.sock"))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		field string
+		got   string
+		want  string
+	}{
+		{"root", cfg.ProjectRootFolder, dir},
+		{"exec", cfg.ExecutablePackageFolder, filepath.Join(dir, "cmd", "dev")},
+		{"env_file", cfg.EnvFiles[0], filepath.Join(dir, "base", ".env.local")},
+		{"tls.cert", cfg.Ports[0].Tls.Cert, filepath.Join(dir, "base", "certs", "cert.pem")},
+		{"tls.key", cfg.Ports[0].Tls.Key, "/etc/revolver/key.pem"},
+		// --set is relative to the working directory
+		{"socket", cfg.Ports[0].Socket, "run/api.sock"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.field, tt.got, tt.want)
+		}
+	}
+}
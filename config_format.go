@@ -0,0 +1,595 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+type ConfigFormat string
+
+const (
+	ConfigFormatYaml ConfigFormat = "yaml"
+	ConfigFormatJson ConfigFormat = "json"
+	ConfigFormatToml ConfigFormat = "toml"
+)
+
+// ConfigSection is the key of a section holding the config inside a file that is mainly about
+// something else, like package.json or pyproject.toml.
+const ConfigSection = "revolver"
+
+var ConfigUnknownFormatError = errors.New("unknown config format")
+
+// ConfigFormatOf detects the format of a config file by its extension, falling back to yaml.
+func ConfigFormatOf(filename string) ConfigFormat {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return ConfigFormatJson
+	case ".toml":
+		return ConfigFormatToml
+	}
+
+	return ConfigFormatYaml
+}
+
+// parseConfig parses a config file of any format into a yaml mapping with the positions of the file.
+// A top level revolver section is returned instead of the whole file.
+func parseConfig(format ConfigFormat, data []byte) (*yaml.Node, *ConfigError) {
+	doc := &yaml.Node{}
+	switch format {
+	case ConfigFormatToml:
+		root, err := parseToml(data)
+		if err != nil {
+			return nil, err
+		}
+		doc = root
+	case ConfigFormatJson:
+		root, err := parseJson(data)
+		if err != nil {
+			return nil, err
+		}
+		doc = root
+	default:
+		if err := yaml.Unmarshal(data, doc); err != nil {
+			return nil, yamlError(err, nil)
+		}
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+
+	if section := mappingValue(root, ConfigSection); section != nil && section.Kind == yaml.MappingNode {
+		return section, nil
+	}
+
+	return root, nil
+}
+
+// decodeConfigNode decodes a config mapping as strictly as a yaml.Decoder with KnownFields,
+// which yaml.Node.Decode does not offer. Errors name the config keys instead of Go types.
+func decodeConfigNode(root *yaml.Node, cfg *RevolverConfig) ConfigErrors {
+	typ := reflect.TypeOf(cfg)
+	errs := ConfigErrors{}
+	walkConfig(root, typ, "", func(node *yaml.Node, field reflect.Type, path string) {
+		if field == nil {
+			errs = append(errs, &ConfigError{Line: node.Line, Column: node.Column, Err: fmt.Errorf("%w: %s", ConfigUnknownFieldError, path)})
+		}
+	})
+
+	if err := root.Decode(cfg); err != nil {
+		typeErr := &yaml.TypeError{}
+		if !errors.As(err, &typeErr) {
+			typeErr.Errors = []string{err.Error()}
+		}
+		for _, msg := range typeErr.Errors {
+			errs = append(errs, decodeError(root, typ, msg))
+		}
+	}
+
+	return errs
+}
+
+var yamlTypeError = regexp.MustCompile(`^(?:yaml: )?line (\d+): cannot unmarshal (.*) into \S+$`)
+
+// decodeError turns a decode error of yaml into a ConfigError on the key it is about,
+// describing the expected value the way the config is written.
+func decodeError(root *yaml.Node, typ reflect.Type, msg string) *ConfigError {
+	match := yamlTypeError.FindStringSubmatch(msg)
+	if match == nil {
+		return yamlError(errors.New(msg), root)
+	}
+
+	// the deepest value on the line that does not decode on its own is the one yaml refused,
+	// its parents are visited before it
+	line, _ := strconv.Atoi(match[1])
+	found, foundType, foundPath := (*yaml.Node)(nil), reflect.Type(nil), ""
+	walkConfig(root, typ, "", func(node *yaml.Node, field reflect.Type, path string) {
+		if field == nil || node.Line != line {
+			return
+		}
+		if err := node.Decode(reflect.New(field).Interface()); err != nil {
+			found, foundType, foundPath = node, field, path
+		}
+	})
+	if found == nil {
+		return yamlError(errors.New(msg), root)
+	}
+
+	return &ConfigError{Line: found.Line, Column: found.Column, Err: fmt.Errorf("%w: %s: cannot unmarshal %s into %s", ConfigDecodeError, foundPath, match[2], configKind(foundType))}
+}
+
+// configKind names what a config value of typ has to look like.
+func configKind(typ reflect.Type) string {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if typ == reflect.TypeOf(time.Duration(0)) {
+		return "a duration"
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "a mapping"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	}
+
+	return "a string"
+}
+
+// walkConfig calls visit for node and every value below it with the type it decodes into and
+// its key path, like ports[0].tls.cert. Mapping keys typ has no field for are visited with a nil type.
+func walkConfig(node *yaml.Node, typ reflect.Type, path string, visit func(*yaml.Node, reflect.Type, string)) {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	if path != "" {
+		visit(node, typ, path)
+	}
+
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			break
+		}
+		fields := yamlFields(typ)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			field, ok := fields[key.Value]
+			if !ok {
+				visit(key, nil, join(key.Value))
+				continue
+			}
+			walkConfig(node.Content[i+1], field, join(key.Value), visit)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			break
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			walkConfig(node.Content[i+1], typ.Elem(), join(node.Content[i].Value), visit)
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			break
+		}
+		for i, item := range node.Content {
+			walkConfig(item, typ.Elem(), path+"["+strconv.Itoa(i)+"]", visit)
+		}
+	}
+}
+
+// yamlFields maps the yaml keys of a struct to the types of their fields, the way yaml.v3 names them.
+func yamlFields(typ reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		switch {
+		case name == "-":
+			continue
+		case strings.Contains(opts, "inline"):
+			for key, t := range yamlFields(field.Type) {
+				fields[key] = t
+			}
+			continue
+		case name == "":
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+
+	return fields
+}
+
+// EncodeConfig writes a config in the given format.
+func EncodeConfig(w io.Writer, cfg RevolverConfig, format ConfigFormat) error {
+	node := &yaml.Node{}
+	if err := node.Encode(cfg); err != nil {
+		return err
+	}
+
+	switch format {
+	case ConfigFormatYaml:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(node); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case ConfigFormatJson:
+		compact := &bytes.Buffer{}
+		if err := writeJson(compact, node); err != nil {
+			return err
+		}
+		indented := &bytes.Buffer{}
+		if err := json.Indent(indented, compact.Bytes(), "", "  "); err != nil {
+			return err
+		}
+		indented.WriteByte('\n')
+		_, err := indented.WriteTo(w)
+		return err
+	case ConfigFormatToml:
+		value := map[string]any{}
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		encoder := toml.NewEncoder(w)
+		return encoder.Encode(value)
+	}
+
+	return fmt.Errorf("%w: %s", ConfigUnknownFormatError, format)
+}
+
+// writeJson writes a yaml node as compact json, keeping the order of mapping keys.
+func writeJson(w *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		return writeJson(w, node.Content[0])
+	case yaml.MappingNode:
+		w.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			key, _ := json.Marshal(node.Content[i].Value)
+			w.Write(key)
+			w.WriteByte(':')
+			if err := writeJson(w, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('}')
+	case yaml.SequenceNode:
+		w.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := writeJson(w, item); err != nil {
+				return err
+			}
+		}
+		w.WriteByte(']')
+	case yaml.ScalarNode:
+		value := any(nil)
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		w.Write(data)
+	default:
+		return fmt.Errorf("cannot write yaml node kind %d as json", node.Kind)
+	}
+
+	return nil
+}
+
+// parseJson parses a json document into a yaml document with the same structure and positions.
+func parseJson(data []byte) (*yaml.Node, *ConfigError) {
+	doc := &yaml.Node{Kind: yaml.DocumentNode}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return doc, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	j := jsonConverter{data: data, dec: dec}
+
+	root, err := j.value()
+	if err == nil {
+		// anything after the document
+		_, line, column, tokenErr := j.next()
+		switch {
+		case tokenErr == nil:
+			return nil, &ConfigError{Line: line, Column: column, Err: fmt.Errorf("%w: invalid character after top-level value", ConfigDecodeError)}
+		case tokenErr != io.EOF:
+			err = tokenErr
+		}
+	}
+	if err != nil {
+		offset := dec.InputOffset()
+		syntaxErr := &json.SyntaxError{}
+		if errors.As(err, &syntaxErr) {
+			offset = syntaxErr.Offset
+			// the offset is past the character that failed, unless the input ended early
+			if offset < int64(len(data)) {
+				offset--
+			}
+		}
+		line, column := j.position(offset)
+		return nil, &ConfigError{Line: line, Column: column, Err: fmt.Errorf("%w: %v", ConfigDecodeError, err)}
+	}
+
+	doc.Content = []*yaml.Node{root}
+	return doc, nil
+}
+
+type jsonConverter struct {
+	data []byte
+	dec  *json.Decoder
+}
+
+// position returns the line and column of an offset into the input, counting characters like yaml does.
+func (j jsonConverter) position(offset int64) (int, int) {
+	before := j.data[:min(offset, int64(len(j.data)))]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := utf8.RuneCount(before[bytes.LastIndexByte(before, '\n')+1:]) + 1
+	return line, column
+}
+
+// next returns the next token and where it starts. The decoder only reports the offset after
+// the previous token, so the separators and whitespace in between are skipped.
+func (j jsonConverter) next() (json.Token, int, int, error) {
+	offset := j.dec.InputOffset()
+	for offset < int64(len(j.data)) && strings.IndexByte(" \t\r\n,:", j.data[offset]) >= 0 {
+		offset++
+	}
+	line, column := j.position(offset)
+
+	token, err := j.dec.Token()
+	return token, line, column, err
+}
+
+func (j jsonConverter) value() (*yaml.Node, error) {
+	token, line, column, err := j.next()
+	if err != nil {
+		return nil, err
+	}
+
+	node := &yaml.Node{Kind: yaml.ScalarNode, Line: line, Column: column}
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '{' {
+			node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		} else {
+			node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		}
+		for j.dec.More() {
+			if node.Kind == yaml.MappingNode {
+				key, line, column, err := j.next()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Style: yaml.DoubleQuotedStyle, Value: key.(string), Line: line, Column: column})
+			}
+			child, err := j.value()
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		// the closing delimiter
+		if _, err := j.dec.Token(); err != nil {
+			return nil, err
+		}
+	case string:
+		node.Tag, node.Style, node.Value = "!!str", yaml.DoubleQuotedStyle, token
+	case json.Number:
+		node.Tag, node.Value = "!!int", token.String()
+		if strings.ContainsAny(node.Value, ".eE") {
+			node.Tag = "!!float"
+		}
+	case bool:
+		node.Tag, node.Value = "!!bool", strconv.FormatBool(token)
+	case nil:
+		node.Tag, node.Value = "!!null", "null"
+	}
+
+	return node, nil
+}
+
+// parseToml parses a toml document into a yaml document with the same structure and positions.
+func parseToml(data []byte) (*yaml.Node, *ConfigError) {
+	// the parser below leaves semantic checks like redefined keys to the decoder
+	if err := toml.Unmarshal(data, &map[string]any{}); err != nil {
+		decodeErr := &toml.DecodeError{}
+		if !errors.As(err, &decodeErr) {
+			return nil, &ConfigError{Err: fmt.Errorf("%w: %v", ConfigDecodeError, err)}
+		}
+		line, column := decodeErr.Position()
+		return nil, &ConfigError{Line: line, Column: column, Err: fmt.Errorf("%w: %s", ConfigDecodeError, strings.TrimPrefix(decodeErr.Error(), "toml: "))}
+	}
+
+	p := &unstable.Parser{}
+	p.Reset(data)
+	t := tomlConverter{parser: p}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1, Column: 1}
+	table := root
+	for p.NextExpression() {
+		expr := p.Expression()
+		switch expr.Kind {
+		case unstable.KeyValue:
+			t.keyValue(table, expr)
+		case unstable.Table:
+			table = t.table(root, expr.Key(), false)
+		case unstable.ArrayTable:
+			table = t.table(root, expr.Key(), true)
+		}
+	}
+
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}, nil
+}
+
+type tomlConverter struct {
+	parser *unstable.Parser
+}
+
+// position returns where a toml node starts, or zeros when the parser does not record it.
+func (t tomlConverter) position(node *unstable.Node) (int, int) {
+	raw := node.Raw
+	if raw.Length == 0 {
+		if len(node.Data) == 0 {
+			return 0, 0
+		}
+		// values without a raw range point into the input with their data
+		raw = t.parser.Range(node.Data)
+	}
+
+	start := t.parser.Shape(raw).Start
+	return start.Line, start.Column
+}
+
+func (t tomlConverter) keyNode(key *unstable.Node) *yaml.Node {
+	line, column := t.position(key)
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(key.Data), Line: line, Column: column}
+}
+
+// child returns the table under key, creating it when missing.
+// An array of tables continues in its last table.
+func (t tomlConverter) child(parent *yaml.Node, key *unstable.Node) *yaml.Node {
+	if value := mappingValue(parent, string(key.Data)); value != nil {
+		if value.Kind == yaml.SequenceNode && len(value.Content) > 0 {
+			return value.Content[len(value.Content)-1]
+		}
+		return value
+	}
+
+	line, column := t.position(key)
+	value := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: line, Column: column}
+	parent.Content = append(parent.Content, t.keyNode(key), value)
+
+	return value
+}
+
+// table returns the table a [table] or [[array table]] header opens.
+func (t tomlConverter) table(root *yaml.Node, keys unstable.Iterator, array bool) *yaml.Node {
+	node := root
+	for keys.Next() {
+		key := keys.Node()
+		if !array || !keys.IsLast() {
+			node = t.child(node, key)
+			continue
+		}
+
+		line, column := t.position(key)
+		tables := mappingValue(node, string(key.Data))
+		if tables == nil {
+			tables = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: line, Column: column}
+			node.Content = append(node.Content, t.keyNode(key), tables)
+		}
+		node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: line, Column: column}
+		tables.Content = append(tables.Content, node)
+	}
+
+	return node
+}
+
+func (t tomlConverter) keyValue(parent *yaml.Node, expr *unstable.Node) {
+	keys := expr.Key()
+	for keys.Next() {
+		key := keys.Node()
+		if !keys.IsLast() {
+			parent = t.child(parent, key)
+			continue
+		}
+		parent.Content = append(parent.Content, t.keyNode(key), t.value(expr.Value(), key))
+	}
+}
+
+// value converts a toml value. Arrays have no position of their own and take the one of their key.
+func (t tomlConverter) value(value, key *unstable.Node) *yaml.Node {
+	line, column := t.position(value)
+	if line == 0 {
+		line, column = t.position(key)
+	}
+
+	node := &yaml.Node{Kind: yaml.ScalarNode, Line: line, Column: column}
+	raw := strings.ReplaceAll(string(value.Data), "_", "")
+	switch value.Kind {
+	case unstable.Array:
+		node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		items := value.Children()
+		for items.Next() {
+			node.Content = append(node.Content, t.value(items.Node(), key))
+		}
+	case unstable.InlineTable:
+		node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		entries := value.Children()
+		for entries.Next() {
+			t.keyValue(node, entries.Node())
+		}
+	case unstable.Bool:
+		node.Tag, node.Value = "!!bool", string(value.Data)
+	case unstable.Integer:
+		n, _ := strconv.ParseInt(raw, 0, 64)
+		node.Tag, node.Value = "!!int", strconv.FormatInt(n, 10)
+	case unstable.Float:
+		switch strings.TrimPrefix(raw, "+") {
+		case "inf":
+			raw = ".inf"
+		case "-inf":
+			raw = "-.inf"
+		case "nan", "-nan":
+			raw = ".nan"
+		}
+		node.Tag, node.Value = "!!float", raw
+	default:
+		// strings, and dates which the config has no fields for
+		node.Tag, node.Value = "!!str", string(value.Data)
+	}
+
+	return node
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadConfigFormats(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"revolver.toml": `log_level = "debug"
+exts = [".go"]
+
+[scripts]
+preload = "go build -o app ."
+run = "./app"
+cleanup = "rm app"
+
+[[ports]]
+name = "http"
+port = 8080
+env = "PORT"
+`,
+		"package.json": `{
+  "name": "web",
+  "revolver": {
+    "extends": "revolver.toml",
+    "exts": [".go", ".tmpl"]
+  }
+}
+`,
+		"bad.toml": "exts = [\".go\"]\n\n[[ports]]\nname = \"http\"\ncolour = \"red\"\n",
+	})
+
+	cfg, _, err := LoadConfig(filepath.Join(dir, "package.json"))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.LogLevel != LogLevelDebug || cfg.Scripts.Run != "./app" {
+		t.Errorf("config = %+v, want the values of revolver.toml", cfg)
+	}
+	if len(cfg.Ports) != 1 || cfg.Ports[0].Port != 8080 || cfg.Ports[0].Env != "PORT" {
+		t.Errorf("ports = %+v, want http on 8080", cfg.Ports)
+	}
+	if !slices.Equal(cfg.ObservingExts, []string{".go", ".tmpl"}) {
+		t.Errorf("exts = %v, want the revolver section of package.json", cfg.ObservingExts)
+	}
+
+	_, _, err = LoadConfig(filepath.Join(dir, "bad.toml"))
+	errs := ConfigErrors{}
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("LoadConfig() error = %v, want 1 ConfigError", err)
+	}
+	if !errors.Is(errs[0], ConfigUnknownFieldError) || errs[0].Line != 5 || errs[0].Column != 1 {
+		t.Errorf("error = %v at %d:%d, want the unknown field at 5:1", errs[0], errs[0].Line, errs[0].Column)
+	}
+}
+
+func TestEncodeConfig(t *testing.T) {
+	// absolute, since relative paths come back resolved against the config directory
+	dir := t.TempDir()
+	cfg := RevolverConfig{
+		LogLevel:                LogLevelInfo,
+		ProjectRootFolder:       dir,
+		ExecutablePackageFolder: dir,
+		Ports:                   []RevolverPortConfig{{Name: "http", Port: 8080, Env: "PORT"}},
+		Scripts:                 RevolverScriptConfig{Preload: "go build -o app .", Run: "./app", CleanUp: "rm app"},
+		ObservingExts:           []string{".go"},
+	}
+
+	for _, format := range []ConfigFormat{ConfigFormatYaml, ConfigFormatJson, ConfigFormatToml} {
+		buf := &bytes.Buffer{}
+		if err := EncodeConfig(buf, cfg, format); err != nil {
+			t.Fatalf("EncodeConfig(%s) error = %v", format, err)
+		}
+
+		filename := filepath.Join(dir, "revolver."+string(format))
+		if err := os.WriteFile(filename, buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		decoded, _, err := LoadConfig(filename)
+		if err != nil {
+			t.Fatalf("LoadConfig(%s) error = %v\n%s", format, err, buf)
+		}
+		decoded.Files = nil
+		if !reflect.DeepEqual(decoded, cfg) {
+			t.Errorf("%s round trip = %+v, want %+v", format, decoded, cfg)
+		}
+	}
+
+	if err := EncodeConfig(&bytes.Buffer{}, cfg, "ini"); !errors.Is(err, ConfigUnknownFormatError) {
+		t.Errorf("EncodeConfig(ini) error = %v, want %v", err, ConfigUnknownFormatError)
+	}
+}
+
+func TestParseJson(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		// exec is the decoded exec field, or line and column point at the error
+		exec         string
+		line, column int
+	}{
+		{name: "escaped slash", input: `{"exec": "cmd\/app"}`, exec: "cmd/app"},
+		{name: "unicode escape", input: `{"exec": "caf\u00e9"}`, exec: "café"},
+		{name: "yaml lookalike", input: `{"exec": "a: b # c"}`, exec: "a: b # c"},
+		{name: "empty", input: "  \n"},
+		{name: "syntax error", input: "{\n  \"exec\": \"cmd\",\n  \"root\" \".\"\n}", line: 3, column: 10},
+		{name: "trailing content", input: `{"exec": "cmd"} {}`, line: 1, column: 17},
+		{name: "unterminated", input: `{"exec": "cmd"`, line: 1, column: 15},
+		{name: "unknown field", input: "{\n  \"exec\": \"cmd\",\n  \"colour\": \"red\"\n}", line: 3, column: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := parseConfig(ConfigFormatJson, []byte(tt.input))
+			errs := ConfigErrors(nil)
+			if err != nil {
+				errs = ConfigErrors{err}
+			} else {
+				cfg := RevolverConfig{}
+				errs = decodeConfigNode(root, &cfg)
+				if len(errs) == 0 && cfg.ExecutablePackageFolder != tt.exec {
+					t.Errorf("exec = %q, want %q", cfg.ExecutablePackageFolder, tt.exec)
+				}
+			}
+
+			if tt.line == 0 {
+				if len(errs) > 0 {
+					t.Errorf("parse error = %v", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Line != tt.line || errs[0].Column != tt.column {
+				t.Errorf("errors = %v, want one at %d:%d", errs, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigNodeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"unknown field", "ext: [.go]", "1:1: unknown field: ext"},
+		{"unknown nested field", "ports:\n  - name: api\n    colour: red", "3:5: unknown field: ports[0].colour"},
+		{"unknown field in profile", "profiles:\n  debug:\n    scripts:\n      build: go build", "4:7: unknown field: profiles.debug.scripts.build"},
+		{"integer", "ports:\n  - port: http", "2:11: failed to decode: ports[0].port: cannot unmarshal !!str `http` into an integer"},
+		{"duration", "drain_timeout: soon", "1:16: failed to decode: drain_timeout: cannot unmarshal !!str `soon` into a duration"},
+		{"mapping", "scripts: go build", "1:10: failed to decode: scripts: cannot unmarshal !!str `go build` into a mapping"},
+		{"list", "exts: .go", "1:7: failed to decode: exts: cannot unmarshal !!str `.go` into a list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &yaml.Node{}
+			if err := yaml.Unmarshal([]byte(tt.input), doc); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			errs := decodeConfigNode(doc.Content[0], &RevolverConfig{})
+			if len(errs) != 1 || errs[0].Error() != tt.want {
+				t.Errorf("decodeConfigNode() = %v, want %s", errs, tt.want)
+			}
+		})
+	}
+}
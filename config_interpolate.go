@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ConfigInterpolationError = errors.New("invalid variable reference")
+
+// InterpolateConfig substitutes ${VAR} and ${VAR:-default} in the scalar values of a parsed
+// config, so comments, keys and the structure of the file are never touched. An unset variable
+// becomes empty, or the default when one is given. $$ stands for a literal $, a $ that does not
+// start a reference is kept as is. A value with a reference is typed once substituted, so a
+// variable can fill a number or a boolean, and string fields still get the text.
+func InterpolateConfig(root *yaml.Node, lookup func(string) (string, bool)) error {
+	errs := interpolateNode(root, lookup, nil)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func interpolateNode(node *yaml.Node, lookup func(string) (string, bool), errs ConfigErrors) ConfigErrors {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "$") {
+			return errs
+		}
+
+		value, substituted, columns, refErrs := interpolateValue(node.Value, lookup)
+		for i, err := range refErrs {
+			configErr := &ConfigError{Line: node.Line, Column: node.Column, Err: err}
+			// only a plain value on one line maps its characters to the columns of the file
+			if node.Style == 0 && !strings.Contains(node.Value, "\n") {
+				configErr.Column += columns[i]
+			}
+			errs = append(errs, configErr)
+		}
+
+		node.Value = value
+		if substituted && node.Style&yaml.TaggedStyle == 0 {
+			// json and toml can only quote a reference, so quoting does not make it a string
+			node.Tag = ""
+			node.Style &^= yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle | yaml.LiteralStyle | yaml.FoldedStyle
+		}
+	case yaml.MappingNode:
+		// keys are left alone so a variable cannot add or rename fields
+		for i := 1; i < len(node.Content); i += 2 {
+			errs = interpolateNode(node.Content[i], lookup, errs)
+		}
+	default:
+		for _, child := range node.Content {
+			errs = interpolateNode(child, lookup, errs)
+		}
+	}
+
+	return errs
+}
+
+// interpolateValue substitutes the references in a single value. substituted reports whether
+// it had any, columns holds the character offset of the reference each error is about.
+func interpolateValue(value string, lookup func(string) (string, bool)) (string, bool, []int, []error) {
+	out := strings.Builder{}
+	out.Grow(len(value))
+	substituted := false
+	columns, errs := []int(nil), []error(nil)
+
+	for pos := 0; ; {
+		idx := strings.IndexByte(value[pos:], '$')
+		if idx < 0 {
+			out.WriteString(value[pos:])
+			break
+		}
+		out.WriteString(value[pos : pos+idx])
+		pos += idx
+		rest := value[pos:]
+
+		switch {
+		case strings.HasPrefix(rest, "$$"):
+			out.WriteByte('$')
+			pos += 2
+			continue
+		case !strings.HasPrefix(rest, "${"):
+			out.WriteByte('$')
+			pos++
+			continue
+		}
+
+		// columns count characters like the yaml parser does
+		report := func(err error) {
+			columns = append(columns, utf8.RuneCountInString(value[:pos]))
+			errs = append(errs, err)
+		}
+
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			report(fmt.Errorf("%w: missing closing brace", ConfigInterpolationError))
+			out.WriteString(rest)
+			break
+		}
+
+		name, fallback, hasDefault := strings.Cut(rest[2:end], ":-")
+		if !isEnvName(name) {
+			report(fmt.Errorf("%w: %q is not a variable name", ConfigInterpolationError, name))
+		}
+
+		resolved, ok := lookup(name)
+		if (!ok || resolved == "") && hasDefault {
+			resolved = fallback
+		}
+		out.WriteString(resolved)
+		substituted = true
+		pos += end + 1
+	}
+
+	return out.String(), substituted, columns, errs
+}
+
+// isEnvName reports whether name is a valid environment variable name.
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ConfigInvalidOverrideError = errors.New("invalid override")
+
+// ConfigOverrideFile is how errors refer to values given on the command line.
+const ConfigOverrideFile = "--set"
+
+// applyOverrides sets path=value overrides in root. A path is a dot separated list of keys
+// where numbers index lists, like ports.0.port. Values are read like plain yaml scalars,
+// and lists or mappings can be given in flow style, like exts=[.go,.mod].
+func (d *ConfigDocument) applyOverrides(root *yaml.Node, overrides []string) ConfigErrors {
+	errs := ConfigErrors{}
+	for _, override := range overrides {
+		invalid := func(err error) {
+			errs = append(errs, &ConfigError{File: ConfigOverrideFile, Err: fmt.Errorf("%s: %w", override, err)})
+		}
+
+		path, raw, ok := strings.Cut(override, "=")
+		if !ok || path == "" {
+			invalid(fmt.Errorf("%w: expected path=value", ConfigInvalidOverrideError))
+			continue
+		}
+
+		keys := strings.Split(path, ".")
+		value := overrideValue(raw)
+		d.mark(value, ConfigOverrideFile)
+
+		// decoded on its own first, since the merged tree has no position to report for it
+		if decodeErrs := decodeConfigNode(overrideTree(keys, value), &RevolverConfig{}); len(decodeErrs) > 0 {
+			for _, e := range decodeErrs {
+				invalid(e.Err)
+			}
+			continue
+		}
+
+		if err := d.set(root, keys, value); err != nil {
+			invalid(err)
+		}
+	}
+
+	return errs
+}
+
+// set replaces the node at keys below node with value, creating the mappings and lists on the way.
+func (d *ConfigDocument) set(node *yaml.Node, keys []string, value *yaml.Node) error {
+	key := keys[0]
+
+	i := 0
+	switch node.Kind {
+	case yaml.MappingNode:
+		if i = mappingIndex(node, key); i < 0 {
+			keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+			d.mark(keyNode, ConfigOverrideFile)
+			node.Content = append(node.Content, keyNode, nil)
+			i = len(node.Content) - 2
+		}
+		i++
+	case yaml.SequenceNode:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index > len(node.Content) {
+			return fmt.Errorf("%w: no item %s in a list of %d", ConfigInvalidOverrideError, key, len(node.Content))
+		}
+		if index == len(node.Content) {
+			node.Content = append(node.Content, nil)
+		}
+		i = index
+	default:
+		return fmt.Errorf("%w: %s is not a mapping or a list", ConfigInvalidOverrideError, key)
+	}
+
+	if len(keys) == 1 {
+		node.Content[i] = value
+		return nil
+	}
+
+	child := node.Content[i]
+	if child == nil || (child.Kind != yaml.MappingNode && child.Kind != yaml.SequenceNode) {
+		child = overrideContainer(keys[1])
+		d.mark(child, ConfigOverrideFile)
+		node.Content[i] = child
+	}
+
+	return d.set(child, keys[1:], value)
+}
+
+// overrideValue reads the value of an override, flow style lists and mappings as yaml
+// and anything else as a plain scalar, so a value like "./app -debug" stays a string.
+func overrideValue(raw string) *yaml.Node {
+	if strings.HasPrefix(raw, "[") || strings.HasPrefix(raw, "{") {
+		doc := &yaml.Node{}
+		if err := yaml.Unmarshal([]byte(raw), doc); err == nil && len(doc.Content) > 0 {
+			return doc.Content[0]
+		}
+	}
+
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: raw}
+}
+
+// overrideTree nests value under keys, so it can be decoded like a config of its own.
+func overrideTree(keys []string, value *yaml.Node) *yaml.Node {
+	node := value
+	for i := len(keys) - 1; i >= 0; i-- {
+		if _, err := strconv.Atoi(keys[i]); err == nil && i > 0 {
+			node = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{node}}
+			continue
+		}
+		node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!str", Value: keys[i]}, node}}
+	}
+
+	return node
+}
+
+func overrideContainer(key string) *yaml.Node {
+	if _, err := strconv.Atoi(key); err == nil {
+		return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLoadConfigOverrides(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"dev.yaml": `log_level: info
+scripts:
+  preload: go build -o app .
+  run: ./app
+  cleanup: rm app
+ports:
+  - name: http
+    port: 8080
+    env: PORT
+exts: [.go]
+`,
+	})
+	filename := filepath.Join(dir, "dev.yaml")
+
+	cfg, _, err := LoadConfig(filename, WithOverrides(
+		"log_level=debug",
+		"scripts.run=./app -debug",
+		"ports.0.port=9090",
+		"ports.1.name=admin",
+		"exts=[.go,.tmpl]",
+		"ready.timeout=5s",
+	))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.LogLevel != LogLevelDebug || cfg.Scripts.Run != "./app -debug" {
+		t.Errorf("log level = %s, run = %q, want the overrides", cfg.LogLevel, cfg.Scripts.Run)
+	}
+	if len(cfg.Ports) != 2 || cfg.Ports[0].Port != 9090 || cfg.Ports[0].Name != "http" || cfg.Ports[1].Name != "admin" {
+		t.Errorf("ports = %+v, want http on 9090 and admin", cfg.Ports)
+	}
+	if !slices.Equal(cfg.ObservingExts, []string{".go", ".tmpl"}) {
+		t.Errorf("exts = %v, want [.go .tmpl]", cfg.ObservingExts)
+	}
+	if cfg.Ready.Timeout.String() != "5s" {
+		t.Errorf("ready timeout = %s, want 5s", cfg.Ready.Timeout)
+	}
+
+	_, _, err = LoadConfig(filename, WithOverrides("ports.0.port=abc", "colour=red", "ports.5.port=1", "log_level"))
+	errs := ConfigErrors{}
+	if !errors.As(err, &errs) || len(errs) != 4 {
+		t.Fatalf("LoadConfig() error = %v, want 4 ConfigErrors", err)
+	}
+	for _, e := range errs {
+		if e.File != ConfigOverrideFile {
+			t.Errorf("error %v is in %q, want %q", e, e.File, ConfigOverrideFile)
+		}
+	}
+	if !errors.Is(errs[2], ConfigInvalidOverrideError) || !errors.Is(errs[3], ConfigInvalidOverrideError) {
+		t.Errorf("errors = %v, want %v for the missing item and the missing value", errs, ConfigInvalidOverrideError)
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"revolver.toml":       "",
+		"svc/dev.yaml":        "",
+		"svc/api/main.go":     "",
+		"svc/api/handlers.go": "",
+	})
+
+	found, err := FindConfig(filepath.Join(dir, "svc", "api"))
+	if err != nil {
+		t.Fatalf("FindConfig() error = %v", err)
+	}
+	if want := filepath.Join(dir, "svc", "dev.yaml"); found != want {
+		t.Errorf("FindConfig() = %s, want %s", found, want)
+	}
+
+	found, err = FindConfig(dir)
+	if err != nil || found != filepath.Join(dir, "revolver.toml") {
+		t.Errorf("FindConfig() = %s, %v, want revolver.toml", found, err)
+	}
+}
+
+func TestConfigFileRelativePaths(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"svc/dev.yaml": `root: .
+exec: api
+scripts:
+  preload: go build -o app .
+  run: ./app
+  cleanup: rm app
+`,
+		"svc/api/main.go": "",
+	})
+	api := filepath.Join(dir, "svc", "api")
+	t.Chdir(api)
+
+	filename, err := configFile(nil)
+	if err != nil {
+		t.Fatalf("configFile() error = %v", err)
+	}
+	if wd, _ := os.Getwd(); wd != api {
+		t.Errorf("working directory = %s after configFile(), want %s", wd, api)
+	}
+
+	flags := configFlags{root: "."}
+	cfg, err := ReadConfig(filename, flags.options()...)
+	if err != nil {
+		t.Fatalf("ReadConfig() error = %v", err)
+	}
+	// the file is read from its own directory, --root from the working directory
+	if cfg.ExecutablePackageFolder != api {
+		t.Errorf("exec = %s, want %s", cfg.ExecutablePackageFolder, api)
+	}
+	if cfg.ProjectRootFolder != "." {
+		t.Errorf("root = %s, want .", cfg.ProjectRootFolder)
+	}
+}
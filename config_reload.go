@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+)
+
+// ConfigDiff is what changed between the running config and a reloaded one.
+type ConfigDiff struct {
+	LogLevel bool
+	// Watcher is set when the extension filter, the env files or the config files changed
+	Watcher bool
+	// Restart is set when the application has to be restarted to pick up the change
+	Restart bool
+	// AddedPorts holds new and changed ports, RemovedPorts removed and changed ones
+	AddedPorts   []RevolverPortConfig
+	RemovedPorts []RevolverPortConfig
+	// Fixed names the fields that only take effect when revolver itself restarts
+	Fixed []string
+}
+
+func (d ConfigDiff) Empty() bool {
+	return !d.LogLevel && !d.Watcher && !d.Restart && len(d.AddedPorts) == 0 && len(d.RemovedPorts) == 0 && len(d.Fixed) == 0
+}
+
+// DiffConfig compares the running config with a reloaded one.
+// The returned config is the reloaded one with the fields listed in Fixed kept at their running values.
+func DiffConfig(running, reloaded RevolverConfig) (RevolverConfig, ConfigDiff) {
+	diff := ConfigDiff{
+		LogLevel: running.LogLevel != reloaded.LogLevel,
+		Watcher: !slices.Equal(running.ObservingExts, reloaded.ObservingExts) ||
+			!slices.Equal(running.EnvFiles, reloaded.EnvFiles) ||
+			!slices.Equal(running.Files, reloaded.Files),
+		Restart: running.ExecutablePackageFolder != reloaded.ExecutablePackageFolder ||
+			running.Scripts != reloaded.Scripts ||
+			running.Ready != reloaded.Ready ||
+			!slices.Equal(running.EnvFiles, reloaded.EnvFiles),
+	}
+
+	if running.ProjectRootFolder != reloaded.ProjectRootFolder {
+		diff.Fixed = append(diff.Fixed, "root")
+		reloaded.ProjectRootFolder = running.ProjectRootFolder
+	}
+	if running.DrainTimeout != reloaded.DrainTimeout {
+		diff.Fixed = append(diff.Fixed, "drain_timeout")
+		reloaded.DrainTimeout = running.DrainTimeout
+	}
+	if running.Rollback.Keep != reloaded.Rollback.Keep {
+		diff.Fixed = append(diff.Fixed, "rollback.keep")
+		reloaded.Rollback.Keep = running.Rollback.Keep
+	}
+	if running.Rollback.Admin != reloaded.Rollback.Admin {
+		diff.Fixed = append(diff.Fixed, "rollback.admin")
+		reloaded.Rollback.Admin = running.Rollback.Admin
+	}
+	if running.Limits != reloaded.Limits {
+		diff.Fixed = append(diff.Fixed, "limits")
+		reloaded.Limits = running.Limits
+	}
+
+	runningPorts := make(map[string]RevolverPortConfig, len(running.Ports))
+	for _, port := range running.Ports {
+		runningPorts[port.Name] = port
+	}
+
+	// a changed port is replaced by a new proxy, and so are the sni ports routing to it
+	replaced := map[string]bool{}
+	for _, port := range reloaded.Ports {
+		previous, ok := runningPorts[port.Name]
+		if ok && reflect.DeepEqual(previous, port) {
+			continue
+		}
+		if ok {
+			diff.RemovedPorts = append(diff.RemovedPorts, previous)
+		}
+		diff.AddedPorts = append(diff.AddedPorts, port)
+		replaced[port.Name] = true
+	}
+	for _, port := range reloaded.Ports {
+		if replaced[port.Name] || port.HasBackend() {
+			continue
+		}
+		for _, target := range port.Routes {
+			if replaced[target] {
+				diff.RemovedPorts = append(diff.RemovedPorts, runningPorts[port.Name])
+				diff.AddedPorts = append(diff.AddedPorts, port)
+				break
+			}
+		}
+	}
+
+	reloadedNames := make(map[string]bool, len(reloaded.Ports))
+	for _, port := range reloaded.Ports {
+		reloadedNames[port.Name] = true
+	}
+	for _, port := range running.Ports {
+		if !reloadedNames[port.Name] {
+			diff.RemovedPorts = append(diff.RemovedPorts, port)
+		}
+	}
+
+	// the application listens on the backend ports, so it has to learn about new ones
+	for _, port := range slices.Concat(diff.AddedPorts, diff.RemovedPorts) {
+		if port.HasBackend() {
+			diff.Restart = true
+		}
+	}
+
+	return reloaded, diff
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiffConfig(t *testing.T) {
+	running := RevolverConfig{
+		LogLevel:      LogLevelInfo,
+		DrainTimeout:  time.Second,
+		ObservingExts: []string{".go"},
+		Ports: []RevolverPortConfig{
+			{Name: "api", Port: 8080, Env: "PORT"},
+			{Name: "admin", Port: 8081, Env: "ADMIN_PORT"},
+			{Name: "edge", Port: 8443, Mode: PortModeSni, Routes: map[string]string{"api.local": "api"}},
+		},
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		if _, diff := DiffConfig(running, running); !diff.Empty() {
+			t.Errorf("DiffConfig() = %+v, want no changes", diff)
+		}
+	})
+
+	t.Run("live", func(t *testing.T) {
+		reloaded := running
+		reloaded.LogLevel = LogLevelDebug
+		reloaded.ObservingExts = []string{".go", ".tmpl"}
+
+		_, diff := DiffConfig(running, reloaded)
+		if !diff.LogLevel || !diff.Watcher || diff.Restart {
+			t.Errorf("DiffConfig() = %+v, want log level and watcher changes without a restart", diff)
+		}
+	})
+
+	t.Run("fixed", func(t *testing.T) {
+		reloaded := running
+		reloaded.DrainTimeout = time.Minute
+
+		applied, diff := DiffConfig(running, reloaded)
+		if !slices.Equal(diff.Fixed, []string{"drain_timeout"}) || applied.DrainTimeout != running.DrainTimeout {
+			t.Errorf("DiffConfig() fixed = %v, drain timeout = %v, want the running drain timeout kept", diff.Fixed, applied.DrainTimeout)
+		}
+	})
+
+	t.Run("ports", func(t *testing.T) {
+		reloaded := running
+		reloaded.Ports = []RevolverPortConfig{
+			{Name: "api", Port: 9090, Env: "PORT"},
+			running.Ports[2],
+			{Name: "metrics", Port: 9100, Env: "METRICS_PORT"},
+		}
+
+		_, diff := DiffConfig(running, reloaded)
+		names := func(ports []RevolverPortConfig) []string {
+			out := []string{}
+			for _, port := range ports {
+				out = append(out, port.Name)
+			}
+			slices.Sort(out)
+			return out
+		}
+
+		// edge routes to the replaced api proxy, so it is replaced as well
+		if got, want := names(diff.AddedPorts), []string{"api", "edge", "metrics"}; !slices.Equal(got, want) {
+			t.Errorf("added ports = %v, want %v", got, want)
+		}
+		if got, want := names(diff.RemovedPorts), []string{"admin", "api", "edge"}; !slices.Equal(got, want) {
+			t.Errorf("removed ports = %v, want %v", got, want)
+		}
+		if !diff.Restart {
+			t.Errorf("DiffConfig() restart = false, want a restart for the new backend ports")
+		}
+	})
+}
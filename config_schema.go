@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"time"
+)
+
+// ConfigSchemaURL is where the schema of the config is published, kept in sync with revolver.schema.json.
+const ConfigSchemaURL = "https://raw.githubusercontent.com/snowmerak/revolver/main/revolver.schema.json"
+
+// configSchemaEnums lists the values of the string types that only allow a few.
+var configSchemaEnums = map[reflect.Type][]string{
+	reflect.TypeOf(LogLevel("")):        {string(LogLevelDebug), string(LogLevelInfo), string(LogLevelWarn), string(LogLevelError)},
+	reflect.TypeOf(PortMode("")):        {string(PortModeTcp), string(PortModeHttp), string(PortModeSni)},
+	reflect.TypeOf(BackendNetwork("")):  {string(BackendNetworkTcp), string(BackendNetworkUnix)},
+	reflect.TypeOf(ConnLimitPolicy("")): {string(ConnLimitPolicyWait), string(ConnLimitPolicyReject)},
+}
+
+// configSchemaProperties adds to the generated schema of a field, by type and yaml name.
+var configSchemaProperties = map[string]map[string]any{
+	"RevolverPortConfig.routes": {
+		"description":   `Server names routed to backend ports. "*.example.localhost" matches a single label and "*" every other name.`,
+		"propertyNames": map[string]any{"pattern": `^(\*|(\*\.)?[^*]+)$`},
+	},
+}
+
+// durationPattern matches what time.ParseDuration accepts.
+const durationPattern = `^[-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))+)$`
+
+// ConfigSchema returns a JSON Schema of RevolverConfig, generated from its yaml tags.
+func ConfigSchema() map[string]any {
+	root := reflect.TypeOf(RevolverConfig{})
+	g := &configSchemaGenerator{root: root, definitions: map[string]any{}}
+
+	schema := g.object(root)
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["$id"] = ConfigSchemaURL
+	schema["title"] = "revolver"
+	schema["definitions"] = g.definitions
+
+	return schema
+}
+
+// WriteConfigSchema writes the schema of the config as indented json.
+func WriteConfigSchema(w io.Writer) error {
+	data, err := json.MarshalIndent(ConfigSchema(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+type configSchemaGenerator struct {
+	root        reflect.Type
+	definitions map[string]any
+}
+
+func (g *configSchemaGenerator) schema(typ reflect.Type) map[string]any {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if values, ok := configSchemaEnums[typ]; ok {
+		return map[string]any{"type": "string", "enum": values}
+	}
+
+	switch typ {
+	case g.root:
+		// profiles are configs themselves
+		return map[string]any{"$ref": "#"}
+	case reflect.TypeOf(time.Duration(0)):
+		return map[string]any{
+			"type":    []string{"string", "integer"},
+			"pattern": durationPattern,
+		}
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		if _, ok := g.definitions[typ.Name()]; !ok {
+			// reserved before generating, so a type containing itself ends up as a reference
+			g.definitions[typ.Name()] = nil
+			g.definitions[typ.Name()] = g.object(typ)
+		}
+		return map[string]any{"$ref": "#/definitions/" + typ.Name()}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(typ.Elem())}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(typ.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+
+	return map[string]any{}
+}
+
+func (g *configSchemaGenerator) object(typ reflect.Type) map[string]any {
+	properties := map[string]any{}
+	for name, field := range yamlFields(typ) {
+		property := g.schema(field)
+		for key, value := range configSchemaProperties[typ.Name()+"."+name] {
+			property[key] = value
+		}
+		properties[name] = property
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestConfigSchema(t *testing.T) {
+	schema := ConfigSchema()
+
+	properties := schema["properties"].(map[string]any)
+	for name := range yamlFields(reflect.TypeOf(RevolverConfig{})) {
+		if _, ok := properties[name]; !ok {
+			t.Errorf("property %s is missing", name)
+		}
+	}
+	if _, ok := properties["Files"]; ok {
+		t.Errorf("property Files is in the schema, want it skipped like yaml does")
+	}
+
+	profiles := properties["profiles"].(map[string]any)
+	if ref := profiles["additionalProperties"].(map[string]any)["$ref"]; ref != "#" {
+		t.Errorf("profiles refer to %v, want the root schema", ref)
+	}
+
+	port := schema["definitions"].(map[string]any)["RevolverPortConfig"].(map[string]any)
+	mode := port["properties"].(map[string]any)["mode"].(map[string]any)
+	if !reflect.DeepEqual(mode["enum"], []string{"tcp", "http", "sni"}) {
+		t.Errorf("mode enum = %v, want [tcp http sni]", mode["enum"])
+	}
+
+	routes := port["properties"].(map[string]any)["routes"].(map[string]any)
+	pattern := regexp.MustCompile(routes["propertyNames"].(map[string]any)["pattern"].(string))
+	for host, want := range map[string]bool{"api.localhost": true, "*.localhost": true, "*": true, "a*.localhost": false, "*.*.localhost": false} {
+		if got := pattern.MatchString(host); got != want {
+			t.Errorf("route %q allowed = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestConfigSchemaPublished(t *testing.T) {
+	published, err := os.ReadFile("revolver.schema.json")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	generated := &bytes.Buffer{}
+	if err := WriteConfigSchema(generated); err != nil {
+		t.Fatalf("WriteConfigSchema() error = %v", err)
+	}
+
+	if !bytes.Equal(published, generated.Bytes()) {
+		t.Errorf("revolver.schema.json is outdated, regenerate it with `go run . schema revolver.schema.json`")
+	}
+}
+
+func TestCommandSchemaFunc(t *testing.T) {
+	dir := t.TempDir()
+	blocked := filepath.Join(dir, "blocked")
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		fails bool
+		err   error
+	}{
+		{name: "file", args: []string{filepath.Join(dir, "schemas", "revolver.schema.json")}},
+		{name: "too many arguments", args: []string{"a.json", "b.json"}, fails: true, err: CommandTooManyArgumentsError},
+		{name: "unwritable", args: []string{filepath.Join(blocked, "revolver.schema.json")}, fails: true},
+	}
+
+	want := &bytes.Buffer{}
+	if err := WriteConfigSchema(want); err != nil {
+		t.Fatalf("WriteConfigSchema() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CommandSchemaFunc(tt.args)
+			if (err != nil) != tt.fails || (tt.err != nil && !errors.Is(err, tt.err)) {
+				t.Fatalf("CommandSchemaFunc() error = %v, want fails %v with %v", err, tt.fails, tt.err)
+			}
+			if tt.fails {
+				return
+			}
+
+			got, err := os.ReadFile(tt.args[0])
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if !bytes.Equal(got, want.Bytes()) {
+				t.Errorf("written schema differs from WriteConfigSchema()")
+			}
+		})
+	}
+}
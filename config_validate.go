@@ -0,0 +1,515 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/snowmerak/revolver/listener"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ConfigDecodeError          = errors.New("failed to decode")
+	ConfigInvalidLogLevelError = errors.New("invalid log level")
+	ConfigMissingFolderError   = errors.New("folder does not exist")
+	ConfigEmptyScriptError     = errors.New("script is empty")
+	ConfigInvalidExtError      = errors.New("extension must start with a dot")
+	ConfigDuplicateError       = errors.New("duplicate")
+	ConfigMissingFieldError    = errors.New("missing field")
+	ConfigUnknownFieldError    = errors.New("unknown field")
+	ConfigInvalidPortError     = errors.New("invalid port")
+	ConfigPortCollisionError   = errors.New("port collision")
+	ConfigInvalidValueError    = errors.New("invalid value")
+	ConfigSniWithTlsError      = errors.New("tls termination cannot be combined with sni passthrough")
+	ConfigUnknownRouteError    = errors.New("route target is not a known port")
+	ConfigRouteToTlsError      = errors.New("sni passthrough cannot route to a port that terminates tls")
+)
+
+// ConfigError points at the line and column of the config file a problem was found at.
+// Both are zero when the position is unknown. File is set when the problem is in a file
+// the config extends. A warning does not keep revolver from running the config.
+type ConfigError struct {
+	File    string
+	Line    int
+	Column  int
+	Warning bool
+	Err     error
+}
+
+func (e *ConfigError) Error() string {
+	msg := e.Err.Error()
+	if e.Warning {
+		msg = "warning: " + msg
+	}
+
+	switch {
+	case e.Line == 0:
+		return msg
+	case e.Column == 0:
+		return fmt.Sprintf("%d: %s", e.Line, msg)
+	}
+
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, msg)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigErrors collects every problem of a config file, in document order.
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (e ConfigErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// IsConfigFatal reports whether err is more than a set of warnings.
+func IsConfigFatal(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	errs := ConfigErrors{}
+	if !errors.As(err, &errs) {
+		return true
+	}
+
+	for _, e := range errs {
+		if !e.Warning {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ConfigLoadConfig struct {
+	Profiles  []string
+	Overrides []string
+}
+
+// WithProfiles merges the named profiles over the config, in order.
+func WithProfiles(profiles ...string) func(*ConfigLoadConfig) {
+	return func(clc *ConfigLoadConfig) {
+		clc.Profiles = profiles
+	}
+}
+
+// WithOverrides sets path=value overrides in the config after the profiles are merged.
+func WithOverrides(overrides ...string) func(*ConfigLoadConfig) {
+	return func(clc *ConfigLoadConfig) {
+		clc.Overrides = overrides
+	}
+}
+
+// LoadConfig interpolates environment variables into a config file, merges it over the files
+// it extends and the selected profiles and overrides over the result, resolves relative paths
+// against the directory of the file they are written in, and decodes it. Fields
+// RevolverConfig does not know are refused in every file. The returned document keeps the
+// positions for ValidateConfig. Problems in the content are returned as ConfigErrors.
+func LoadConfig(filename string, opt ...func(*ConfigLoadConfig)) (RevolverConfig, *ConfigDocument, error) {
+	lc := &ConfigLoadConfig{}
+	for _, o := range opt {
+		o(lc)
+	}
+
+	cfg := RevolverConfig{}
+
+	doc := newConfigDocument(filename)
+	root, errs, err := doc.load(filename, "", nil)
+	if err != nil {
+		return cfg, nil, err
+	}
+	if root == nil {
+		return cfg, nil, errs
+	}
+
+	root, profileErrs := doc.applyProfiles(root, lc.Profiles)
+	errs = append(errs, profileErrs...)
+	errs = append(errs, doc.applyOverrides(root, lc.Overrides)...)
+	doc.resolvePaths(root)
+	doc.Root = root
+
+	// the files were decoded one by one already, so errors here repeat what was reported
+	if err := root.Decode(&cfg); err != nil && len(errs) == 0 {
+		errs = append(errs, yamlError(err, nil))
+	}
+	cfg.Files = doc.Files
+
+	if len(errs) > 0 {
+		return cfg, doc, errs
+	}
+
+	return cfg, doc, nil
+}
+
+// ReadConfig loads and validates a config file, reporting every problem it finds at once.
+// The config can still be run when IsConfigFatal is false for the returned error.
+func ReadConfig(filename string, opt ...func(*ConfigLoadConfig)) (RevolverConfig, error) {
+	cfg, doc, err := LoadConfig(filename, opt...)
+	if doc == nil {
+		return cfg, err
+	}
+
+	errs := ConfigErrors{}
+	if err != nil && !errors.As(err, &errs) {
+		return cfg, err
+	}
+
+	if err := ValidateConfig(cfg, doc); err != nil {
+		errs = append(errs, err.(ConfigErrors)...)
+	}
+
+	if len(errs) == 0 {
+		return cfg, nil
+	}
+
+	sortConfigErrors(errs)
+	return cfg, errs
+}
+
+// PrintConfigErrors writes one "filename:line:column: message" line per problem.
+func PrintConfigErrors(w io.Writer, filename string, err error) {
+	errs := ConfigErrors{}
+	if !errors.As(err, &errs) {
+		fmt.Fprintf(w, "%s: %v\n", filename, err)
+		return
+	}
+
+	for _, e := range errs {
+		file := filename
+		if e.File != "" {
+			file = e.File
+		}
+		if e.Line == 0 {
+			fmt.Fprintf(w, "%s: %v\n", file, e)
+			continue
+		}
+		fmt.Fprintf(w, "%s:%v\n", file, e)
+	}
+}
+
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlError moves the line number yaml puts into its messages into a ConfigError,
+// taking the column from the first node on that line.
+func yamlError(err error, doc *yaml.Node) *ConfigError {
+	match := yamlErrorLine.FindStringSubmatch(err.Error())
+	if match == nil {
+		return &ConfigError{Err: err}
+	}
+
+	line, _ := strconv.Atoi(match[1])
+	column := 0
+	if doc != nil {
+		column = firstColumn(doc, line)
+	}
+
+	return &ConfigError{Line: line, Column: column, Err: fmt.Errorf("%w: %s", ConfigDecodeError, match[2])}
+}
+
+func firstColumn(node *yaml.Node, line int) int {
+	column := 0
+	if node.Line == line && node.Kind == yaml.ScalarNode {
+		column = node.Column
+	}
+
+	for _, child := range node.Content {
+		if c := firstColumn(child, line); c != 0 && (column == 0 || c < column) {
+			column = c
+		}
+	}
+
+	return column
+}
+
+// nodeAt walks the document along path, map keys as strings and sequence indexes as ints.
+// It returns the deepest node found, so a missing field points at its parent.
+func nodeAt(doc *yaml.Node, path ...any) *yaml.Node {
+	if doc == nil {
+		return nil
+	}
+
+	node := doc
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for _, p := range path {
+		next := (*yaml.Node)(nil)
+		switch key := p.(type) {
+		case string:
+			if node.Kind != yaml.MappingNode {
+				return node
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case int:
+			if node.Kind == yaml.SequenceNode && key < len(node.Content) {
+				next = node.Content[key]
+			}
+		}
+		if next == nil {
+			return node
+		}
+		node = next
+	}
+
+	return node
+}
+
+type configValidator struct {
+	doc  *ConfigDocument
+	errs ConfigErrors
+}
+
+func (v *configValidator) report(err error, path ...any) {
+	v.add(&ConfigError{Err: err}, path...)
+}
+
+func (v *configValidator) warn(err error, path ...any) {
+	v.add(&ConfigError{Warning: true, Err: err}, path...)
+}
+
+func (v *configValidator) add(configErr *ConfigError, path ...any) {
+	if v.doc != nil {
+		if node := nodeAt(v.doc.Root, path...); node != nil {
+			configErr.File, configErr.Line, configErr.Column = v.doc.position(node)
+		}
+	}
+
+	v.errs = append(v.errs, configErr)
+}
+
+func (v *configValidator) folder(name, path string) {
+	if path == "" {
+		return
+	}
+
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		v.warn(fmt.Errorf("%w: %s: %s", ConfigMissingFolderError, name, path), name)
+	}
+}
+
+// ValidateConfig checks a decoded config for problems that only show up once revolver runs.
+// doc positions the errors and may be nil. LoadConfig has already resolved relative folders against
+// the config directory, the ones left relative come from --set and are checked from the working directory.
+func ValidateConfig(cfg RevolverConfig, doc *ConfigDocument) error {
+	v := &configValidator{doc: doc}
+
+	switch cfg.LogLevel {
+	case "", LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		v.report(fmt.Errorf("%w: %s", ConfigInvalidLogLevelError, cfg.LogLevel), "log_level")
+	}
+
+	v.folder("root", cfg.ProjectRootFolder)
+	v.folder("exec", cfg.ExecutablePackageFolder)
+
+	for i, ext := range cfg.ObservingExts {
+		if !strings.HasPrefix(ext, ".") {
+			v.report(fmt.Errorf("%w: %s", ConfigInvalidExtError, ext), "exts", i)
+		}
+	}
+
+	for _, script := range []struct{ key, value string }{
+		{"preload", cfg.Scripts.Preload},
+		{"run", cfg.Scripts.Run},
+		{"cleanup", cfg.Scripts.CleanUp},
+	} {
+		switch {
+		case strings.TrimSpace(script.value) != "":
+		case script.key == "cleanup":
+			// a cleanup that cannot be parsed is only logged when the session stops
+			v.warn(fmt.Errorf("%w: scripts.%s", ConfigEmptyScriptError, script.key), "scripts", script.key)
+		default:
+			v.report(fmt.Errorf("%w: scripts.%s", ConfigEmptyScriptError, script.key), "scripts", script.key)
+		}
+	}
+
+	for i, filename := range cfg.EnvFiles {
+		if _, err := LoadEnvFile(filename); err != nil {
+			v.report(err, "env_file", i)
+		}
+	}
+
+	v.ports(cfg)
+
+	switch cfg.Limits.Policy {
+	case "", ConnLimitPolicyWait, ConnLimitPolicyReject:
+	default:
+		v.report(fmt.Errorf("%w: limits.policy: %s", ConfigInvalidValueError, cfg.Limits.Policy), "limits", "policy")
+	}
+
+	// an inherited listener accepts before the application serves, only a notification tells
+	if len(cfg.Canary.Steps) > 0 && !cfg.Ready.Notify && slices.ContainsFunc(cfg.Ports, func(port RevolverPortConfig) bool { return port.Inherit }) {
+		v.report(fmt.Errorf("%w: canary with inherited listeners needs ready.notify", ConfigInvalidValueError), "canary", "steps")
+	}
+
+	for i, step := range cfg.Canary.Steps {
+		if step < 1 || step > 100 {
+			v.report(fmt.Errorf("%w: canary step must be a percentage from 1 to 100: %d", ConfigInvalidValueError, step), "canary", "steps", i)
+		}
+	}
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+
+	sortConfigErrors(v.errs)
+	return v.errs
+}
+
+func (v *configValidator) ports(cfg RevolverConfig) {
+	names := map[string]int{}
+	envs := map[string]int{}
+	listens := map[string]int{}
+
+	if cfg.Rollback.Admin != "" {
+		if _, err := AdminListenAddr(cfg.Rollback.Admin); err != nil {
+			v.report(fmt.Errorf("%w: rollback.admin: %v", ConfigInvalidValueError, err), "rollback", "admin")
+		} else if port, err := listenPort(cfg.Rollback.Admin); err != nil {
+			v.report(fmt.Errorf("%w: rollback.admin: %v", ConfigInvalidValueError, err), "rollback", "admin")
+		} else {
+			listens["tcp:"+port] = -1
+		}
+	}
+
+	for i, port := range cfg.Ports {
+		if port.Name == "" {
+			v.report(fmt.Errorf("%w: ports[%d].name", ConfigMissingFieldError, i), "ports", i)
+		} else if first, ok := names[port.Name]; ok {
+			v.report(fmt.Errorf("%w: port name %s, first used by ports[%d]", ConfigDuplicateError, port.Name, first), "ports", i, "name")
+		} else {
+			names[port.Name] = i
+		}
+
+		switch port.Mode {
+		case "", PortModeTcp, PortModeHttp, PortModeSni:
+		default:
+			v.report(fmt.Errorf("%w: mode: %s", ConfigInvalidValueError, port.Mode), "ports", i, "mode")
+		}
+
+		switch port.Backend {
+		case "", BackendNetworkTcp, BackendNetworkUnix:
+		default:
+			v.report(fmt.Errorf("%w: backend: %s", ConfigInvalidValueError, port.Backend), "ports", i, "backend")
+		}
+
+		if port.HasBackend() {
+			if port.Env == "" {
+				v.report(fmt.Errorf("%w: ports[%d].env", ConfigMissingFieldError, i), "ports", i)
+			} else if first, ok := envs[port.Env]; ok {
+				v.report(fmt.Errorf("%w: port env %s, first used by ports[%d]", ConfigDuplicateError, port.Env, first), "ports", i, "env")
+			} else {
+				envs[port.Env] = i
+			}
+		}
+
+		if port.Mode == PortModeSni {
+			if port.Tls != nil {
+				v.report(ConfigSniWithTlsError, "ports", i, "tls")
+			}
+			for host, target := range port.Routes {
+				backend, ok := backendPort(cfg.Ports, target)
+				switch {
+				case !ok:
+					v.report(fmt.Errorf("%w: %s routes to %s", ConfigUnknownRouteError, host, target), "ports", i, "routes", host)
+				case backend.Tls != nil:
+					// the backend would get the raw handshake the client meant for it
+					v.report(fmt.Errorf("%w: %s routes to %s", ConfigRouteToTlsError, host, target), "ports", i, "routes", host)
+				}
+			}
+		}
+
+		key := ""
+		switch {
+		case port.Socket != "":
+			key = "unix:" + port.Socket
+			// only a socket left over from a previous run is replaced when the port starts
+			if info, err := os.Lstat(port.Socket); err == nil && info.Mode()&os.ModeSocket == 0 {
+				v.report(fmt.Errorf("%w: %s", listener.NotSocketError, port.Socket), "ports", i, "socket")
+			}
+		case port.Port < 1 || port.Port > 65535:
+			v.report(fmt.Errorf("%w: %d", ConfigInvalidPortError, port.Port), "ports", i, "port")
+			continue
+		default:
+			key = "tcp:" + strconv.Itoa(port.Port)
+		}
+
+		if first, ok := listens[key]; ok {
+			owner := "rollback.admin"
+			if first >= 0 {
+				owner = "ports[" + strconv.Itoa(first) + "]"
+			}
+			field := "port"
+			if port.Socket != "" {
+				field = "socket"
+			}
+			v.report(fmt.Errorf("%w: %s is also used by %s", ConfigPortCollisionError, strings.TrimPrefix(strings.TrimPrefix(key, "tcp:"), "unix:"), owner), "ports", i, field)
+			continue
+		}
+		listens[key] = i
+	}
+}
+
+// backendPort returns the port of the given name when it has a backend.
+func backendPort(ports []RevolverPortConfig, name string) (RevolverPortConfig, bool) {
+	for _, port := range ports {
+		if port.Name == name && port.HasBackend() {
+			return port, true
+		}
+	}
+
+	return RevolverPortConfig{}, false
+}
+
+func listenPort(addr string) (string, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("%w: %s", ConfigInvalidPortError, port)
+	}
+
+	return port, nil
+}
+
+func sortConfigErrors(errs ConfigErrors) {
+	slices.SortStableFunc(errs, func(a, b *ConfigError) int {
+		if a.File != b.File {
+			return strings.Compare(a.File, b.File)
+		}
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+}
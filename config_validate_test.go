@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/snowmerak/revolver/listener"
+	"gopkg.in/yaml.v3"
+)
+
+func TestReadConfig(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "revolver.yaml")
+	config := `log_level: loud
+root: ` + dir + `
+exec: ` + dir + `
+scripts:
+  preload: go build -o app
+  run: ""
+  cleanup: rm app
+ports:
+  - name: api
+    port: 8080
+    env: PORT
+  - name: api
+    port: 8080
+    env: PORT
+  - name: web
+    port: 70000
+    env: WEB_PORT
+    colour: red
+`
+	if err := os.WriteFile(filename, []byte(config), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	_, err := ReadConfig(filename)
+	errs := ConfigErrors{}
+	if !errors.As(err, &errs) {
+		t.Fatalf("ReadConfig() error = %v, want ConfigErrors", err)
+	}
+
+	want := []struct {
+		line int
+		err  error
+	}{
+		{1, ConfigInvalidLogLevelError},
+		{6, ConfigEmptyScriptError},
+		{12, ConfigDuplicateError},
+		{13, ConfigPortCollisionError},
+		{14, ConfigDuplicateError},
+		{16, ConfigInvalidPortError},
+		{18, ConfigUnknownFieldError},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("ReadConfig() errors = %v, want %d errors", err, len(want))
+	}
+	for i, w := range want {
+		if errs[i].Line != w.line || !errors.Is(errs[i], w.err) {
+			t.Errorf("error %d = %v, want line %d: %v", i, errs[i], w.line, w.err)
+		}
+	}
+}
+
+func TestReadConfigValid(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "revolver.yaml")
+	config := `log_level: info
+root: ` + dir + `
+exec: ` + dir + `
+scripts:
+  preload: go build -o app
+  run: ./app
+  cleanup: rm app
+ports:
+  - name: api
+    port: 8080
+    env: PORT
+`
+	if err := os.WriteFile(filename, []byte(config), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if _, err := ReadConfig(filename); err != nil {
+		t.Errorf("ReadConfig() error = %v", err)
+	}
+}
+
+func TestInterpolateConfig(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		value, ok := map[string]string{"DB_URL": "postgres://localhost/dev", "EMPTY": "", "PORT": "8080", "INJECT": "a\nroot: /"}[name]
+		return value, ok
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]any
+	}{
+		{"set", "url: ${DB_URL}", map[string]any{"url": "postgres://localhost/dev"}},
+		{"unset", "url: ${MISSING}", map[string]any{"url": nil}},
+		{"default", "level: ${MISSING:-debug}", map[string]any{"level": "debug"}},
+		{"empty uses default", "level: ${EMPTY:-debug}", map[string]any{"level": "debug"}},
+		{"set ignores default", "url: ${DB_URL:-none}", map[string]any{"url": "postgres://localhost/dev"}},
+		{"escaped", "run: echo $${HOME} $$", map[string]any{"run": "echo ${HOME} $"}},
+		{"bare dollar", "run: echo $HOME", map[string]any{"run": "echo $HOME"}},
+		{"number", "port: ${PORT}", map[string]any{"port": 8080}},
+		{"quoted number", `port: "${PORT}"`, map[string]any{"port": 8080}},
+		{"explicit string", "port: !!str ${PORT}", map[string]any{"port": "8080"}},
+		{"comment", "# ${1X}\nurl: x # ${DB_URL}", map[string]any{"url": "x"}},
+		{"key", "${DB_URL}: x", map[string]any{"${DB_URL}": "x"}},
+		{"no injection", "url: ${INJECT}", map[string]any{"url": "a\nroot: /"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &yaml.Node{}
+			if err := yaml.Unmarshal([]byte(tt.input), doc); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if err := InterpolateConfig(doc, lookup); err != nil {
+				t.Fatalf("InterpolateConfig() error = %v", err)
+			}
+			got := map[string]any{}
+			if err := doc.Decode(&got); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("InterpolateConfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal([]byte("root: .\nexec: ${BROKEN\nrun: echo ${1X}\n"), doc); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	err := InterpolateConfig(doc, lookup)
+	errs := ConfigErrors{}
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("InterpolateConfig() error = %v, want 2 ConfigErrors", err)
+	}
+	if errs[0].Line != 2 || errs[0].Column != 7 || errs[1].Line != 3 || errs[1].Column != 11 {
+		t.Errorf("InterpolateConfig() error = %v, want positions 2:7 and 3:11", err)
+	}
+}
+
+func TestReadConfigWarnings(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "revolver.yaml")
+	config := `root: ` + dir + `
+exec: ` + filepath.Join(dir, "missing") + `
+scripts:
+  preload: go build -o app
+  run: ./app
+  cleanup: ""
+`
+	if err := os.WriteFile(filename, []byte(config), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	_, err := ReadConfig(filename)
+	errs := ConfigErrors{}
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("ReadConfig() error = %v, want 2 ConfigErrors", err)
+	}
+	if IsConfigFatal(err) {
+		t.Errorf("IsConfigFatal() = true, want false for %v", err)
+	}
+	for i, w := range []error{ConfigMissingFolderError, ConfigEmptyScriptError} {
+		if !errs[i].Warning || !errors.Is(errs[i], w) {
+			t.Errorf("error %d = %v, want a warning: %v", i, errs[i], w)
+		}
+	}
+
+	errs = append(errs, &ConfigError{Err: ConfigInvalidPortError})
+	if !IsConfigFatal(errs) {
+		t.Errorf("IsConfigFatal() = false, want true for %v", errs)
+	}
+}
+
+func TestValidateConfigCanaryReadiness(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		inherit bool
+		notify  bool
+		invalid bool
+	}{
+		{name: "probed"},
+		{name: "inherited", inherit: true, invalid: true},
+		{name: "inherited with notify", inherit: true, notify: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := RevolverConfig{
+				ProjectRootFolder:       dir,
+				ExecutablePackageFolder: dir,
+				Scripts:                 RevolverScriptConfig{Preload: "true", Run: "./app", CleanUp: "true"},
+				Ports:                   []RevolverPortConfig{{Name: "api", Port: 8080, Env: "PORT", Inherit: tt.inherit}},
+				Ready:                   RevolverReadyConfig{Notify: tt.notify},
+				Canary:                  RevolverCanaryConfig{Steps: []int{10, 50}},
+			}
+
+			err := ValidateConfig(cfg, nil)
+			if got := errors.Is(err, ConfigInvalidValueError); got != tt.invalid {
+				t.Errorf("ValidateConfig() error = %v, want invalid %v", err, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestValidateConfigSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "revolver")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file.sock")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	socket := filepath.Join(dir, "stale.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer lis.Close()
+
+	tests := []struct {
+		name    string
+		socket  string
+		invalid bool
+	}{
+		{name: "missing", socket: filepath.Join(dir, "new.sock")},
+		{name: "socket", socket: socket},
+		{name: "regular file", socket: file, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := RevolverConfig{
+				ProjectRootFolder:       dir,
+				ExecutablePackageFolder: dir,
+				Scripts:                 RevolverScriptConfig{Preload: "true", Run: "./app", CleanUp: "true"},
+				Ports:                   []RevolverPortConfig{{Name: "api", Socket: tt.socket, Env: "PORT"}},
+			}
+
+			err := ValidateConfig(cfg, nil)
+			if got := errors.Is(err, listener.NotSocketError); got != tt.invalid {
+				t.Errorf("ValidateConfig() error = %v, want invalid %v", err, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestValidateConfigSniRoutes(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		target RevolverPortConfig
+		want   error
+	}{
+		{name: "plaintext", target: RevolverPortConfig{Name: "api", Port: 8081, Env: "API_PORT"}},
+		{name: "tls", target: RevolverPortConfig{Name: "api", Port: 8081, Env: "API_PORT", Tls: &RevolverTlsConfig{Auto: true}}, want: ConfigRouteToTlsError},
+		{name: "sni", target: RevolverPortConfig{Name: "api", Port: 8081, Mode: PortModeSni}, want: ConfigUnknownRouteError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := RevolverConfig{
+				ProjectRootFolder:       dir,
+				ExecutablePackageFolder: dir,
+				Scripts:                 RevolverScriptConfig{Preload: "true", Run: "./app", CleanUp: "true"},
+				Ports: []RevolverPortConfig{
+					tt.target,
+					{Name: "https", Port: 8443, Mode: PortModeSni, Routes: map[string]string{"*": "api"}},
+				},
+			}
+
+			err := ValidateConfig(cfg, nil)
+			if tt.want == nil && err != nil {
+				t.Errorf("ValidateConfig() error = %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("ValidateConfig() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/rs/zerolog/log"
+)
+
+// ConnLimiter caps the number of open client connections across every proxy sharing it.
+type ConnLimiter struct {
+	slots  chan struct{}
+	policy ConnLimitPolicy
+}
+
+// NewConnLimiter returns a limiter for max connections, or nil when max is not positive.
+// An empty policy falls back to ConnLimitPolicyWait.
+func NewConnLimiter(max int, policy ConnLimitPolicy) *ConnLimiter {
+	if max <= 0 {
+		return nil
+	}
+
+	if policy == "" {
+		policy = ConnLimitPolicyWait
+	}
+
+	return &ConnLimiter{
+		slots:  make(chan struct{}, max),
+		policy: policy,
+	}
+}
+
+// Acquire takes a slot, waiting for one to free up until ctx is done.
+func (l *ConnLimiter) Acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// TryAcquire takes a slot if one is free.
+func (l *ConnLimiter) TryAcquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *ConnLimiter) Release() {
+	<-l.slots
+}
+
+// Listener applies the limiter to the connections accepted from lis.
+// A slot is held until the connection is closed.
+func (l *ConnLimiter) Listener(ctx context.Context, lis net.Listener) net.Listener {
+	return &limitListener{Listener: lis, ctx: ctx, limiter: l}
+}
+
+type limitListener struct {
+	net.Listener
+	ctx     context.Context
+	limiter *ConnLimiter
+}
+
+func (ll *limitListener) Accept() (net.Conn, error) {
+	for {
+		if ll.limiter.policy == ConnLimitPolicyWait && !ll.limiter.Acquire(ll.ctx) {
+			return nil, net.ErrClosed
+		}
+
+		conn, err := ll.Listener.Accept()
+		if err != nil {
+			if ll.limiter.policy == ConnLimitPolicyWait {
+				ll.limiter.Release()
+			}
+			return nil, err
+		}
+
+		if ll.limiter.policy != ConnLimitPolicyWait && !ll.limiter.TryAcquire() {
+			// RemoteAddr of a PROXY protocol connection would wait for its header
+			remote := conn.RemoteAddr
+			if pc, ok := conn.(*proxyproto.Conn); ok {
+				remote = pc.Raw().RemoteAddr
+			}
+			log.Warn().Str("remote_ip", remote().String()).Int("max_connections", cap(ll.limiter.slots)).Msg("rejected connection over the limit")
+			conn.Close()
+			continue
+		}
+
+		return &limitedConn{Conn: conn, release: ll.limiter.Release}, nil
+	}
+}
+
+// limitedConn gives its slot back when it is closed.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+func (c *limitedConn) NetConn() net.Conn {
+	return c.Conn
+}
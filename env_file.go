@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var EnvFileSyntaxError = errors.New("invalid env file line")
+
+// LoadEnvFiles reads every env file in order and returns their variables as KEY=VALUE.
+// A variable set by a later file overrides the one from an earlier file.
+func LoadEnvFiles(filenames []string) ([]string, error) {
+	env := []string(nil)
+	for _, filename := range filenames {
+		vars, err := LoadEnvFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, vars...)
+	}
+
+	return env, nil
+}
+
+func LoadEnvFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open env file: %w", err)
+	}
+	defer file.Close()
+
+	env, err := ParseEnvFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", filename, err)
+	}
+
+	return env, nil
+}
+
+// ParseEnvFile reads KEY=VALUE lines in the .env format.
+// Blank lines and lines starting with # are skipped and a leading export is ignored.
+// Double quoted values understand \n, \t, \" and \\, single quoted values are taken literally
+// and a # after whitespace starts a comment in unquoted values.
+func ParseEnvFile(r io.Reader) ([]string, error) {
+	env := []string(nil)
+	scanner := bufio.NewScanner(r)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !isEnvName(key) {
+			return nil, fmt.Errorf("%d: %w: %s", n, EnvFileSyntaxError, line)
+		}
+
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%d: %w: %s", n, err, line)
+		}
+
+		env = append(env, key+"="+value)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+func parseEnvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	switch quote := value[0]; quote {
+	case '\'':
+		end := strings.IndexByte(value[1:], quote)
+		if end < 0 {
+			return "", EnvFileSyntaxError
+		}
+		return value[1 : end+1], nil
+	case '"':
+		sb := strings.Builder{}
+		for i := 1; i < len(value); i++ {
+			switch c := value[i]; {
+			case c == '"':
+				return sb.String(), nil
+			case c == '\\' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 't':
+					sb.WriteByte('\t')
+				default:
+					sb.WriteByte(value[i])
+				}
+			default:
+				sb.WriteByte(c)
+			}
+		}
+		return "", EnvFileSyntaxError
+	}
+
+	if idx := strings.Index(value, " #"); idx >= 0 {
+		value = strings.TrimSpace(value[:idx])
+	}
+
+	return value, nil
+}
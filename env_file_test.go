@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	input := `# database
+DB_URL=postgres://localhost/dev
+export FEATURE_X = on # enabled locally
+
+QUOTED="line one\nline \"two\""
+LITERAL='$HOME # kept'
+EMPTY=
+`
+	got, err := ParseEnvFile(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseEnvFile() error = %v", err)
+	}
+
+	want := []string{
+		"DB_URL=postgres://localhost/dev",
+		"FEATURE_X=on",
+		"QUOTED=line one\nline \"two\"",
+		"LITERAL=$HOME # kept",
+		"EMPTY=",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseEnvFile() = %q, want %q", got, want)
+	}
+
+	for _, input := range []string{"NO_EQUALS", "1X=y", `OPEN="unterminated`} {
+		if _, err := ParseEnvFile(strings.NewReader(input)); !errors.Is(err, EnvFileSyntaxError) {
+			t.Errorf("ParseEnvFile(%q) error = %v, want %v", input, err, EnvFileSyntaxError)
+		}
+	}
+}
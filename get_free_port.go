@@ -1,9 +1,16 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"strconv"
 )
 
+var GetFreeUnixSocketExistsError = errors.New("unix socket path already exists")
+
 func GetFreeTcpPort() (int, error) {
 	conn, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
 	if err != nil {
@@ -14,16 +21,91 @@ func GetFreeTcpPort() (int, error) {
 	return conn.Addr().(*net.TCPAddr).Port, nil
 }
 
-func GetFreeTcpPortEnv(portSet []RevolverPortConfig) (map[string]int, error) {
-	env := make(map[string]int, len(portSet))
+// GetFreeUnixSocket returns a socket path unique to the session and port name.
+// Unlike a probed tcp port, no other process can take the path between allocation and bind.
+func GetFreeUnixSocket(session, name string) (string, error) {
+	dir := filepath.Join(os.TempDir(), "revolver")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	// the tail of a uuid v7 is random, and socket paths are limited to ~104 bytes
+	if len(session) > 12 {
+		session = session[len(session)-12:]
+	}
+
+	path := filepath.Join(dir, session+"-"+name+".sock")
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("%s: %w", path, GetFreeUnixSocketExistsError)
+	}
+
+	return path, nil
+}
+
+// GetBackendAddrs allocates the address each port's backend binds to for a session.
+// Ports with inherit enabled are bound right away and returned as listeners to pass to the application.
+func GetBackendAddrs(session string, portSet []RevolverPortConfig) (map[string]net.Addr, []InheritedListener, error) {
+	addrs := make(map[string]net.Addr, len(portSet))
+	listeners := []InheritedListener(nil)
 	for _, port := range portSet {
+		if !port.HasBackend() {
+			continue
+		}
+
+		if port.Inherit {
+			network, addr := "tcp", "127.0.0.1:0"
+			if port.Backend == BackendNetworkUnix {
+				path, err := GetFreeUnixSocket(session, port.Name)
+				if err != nil {
+					CloseInheritedListeners(listeners)
+					return nil, nil, err
+				}
+				network, addr = "unix", path
+			}
+
+			boundAddr, l, err := OpenInheritedListener(port.Name, network, addr)
+			if err != nil {
+				CloseInheritedListeners(listeners)
+				return nil, nil, err
+			}
+
+			addrs[port.Name] = boundAddr
+			listeners = append(listeners, l)
+			continue
+		}
+
+		if port.Backend == BackendNetworkUnix {
+			path, err := GetFreeUnixSocket(session, port.Name)
+			if err != nil {
+				CloseInheritedListeners(listeners)
+				return nil, nil, err
+			}
+
+			addrs[port.Name] = &net.UnixAddr{Name: path, Net: "unix"}
+			continue
+		}
+
 		freePort, err := GetFreeTcpPort()
 		if err != nil {
-			return nil, err
+			CloseInheritedListeners(listeners)
+			return nil, nil, err
 		}
 
-		env[port.Name] = freePort
+		addrs[port.Name] = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: freePort}
 	}
 
-	return env, nil
+	return addrs, listeners, nil
+}
+
+// BackendEnvValue formats a backend address the way it is handed to the application:
+// the port number for tcp and the socket path for unix.
+func BackendEnvValue(addr net.Addr) string {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return strconv.FormatInt(int64(addr.Port), 10)
+	case *net.UnixAddr:
+		return addr.Name
+	default:
+		return addr.String()
+	}
 }
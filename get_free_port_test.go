@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetFreeUnixSocket(t *testing.T) {
+	session := "0192f0c4-7a1b-7c3d-9e8f-0123456789ab"
+
+	path, err := GetFreeUnixSocket(session, "web")
+	if err != nil {
+		t.Fatalf("GetFreeUnixSocket() error = %v", err)
+	}
+	if want := filepath.Join(os.TempDir(), "revolver", "0123456789ab-web.sock"); path != want {
+		t.Errorf("path = %s, want %s", path, want)
+	}
+	if !strings.HasPrefix(path, os.TempDir()) || len(path) > 104 {
+		t.Errorf("path = %s, want a short path in the temp dir", path)
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer lis.Close()
+
+	if _, err := GetFreeUnixSocket(session, "web"); !errors.Is(err, GetFreeUnixSocketExistsError) {
+		t.Errorf("GetFreeUnixSocket() error = %v for a taken path, want %v", err, GetFreeUnixSocketExistsError)
+	}
+
+	other, err := GetFreeUnixSocket(session, "api")
+	if err != nil {
+		t.Fatalf("GetFreeUnixSocket() error = %v", err)
+	}
+	if other == path {
+		t.Errorf("path of another port = %s, want it to differ", other)
+	}
+}
@@ -5,6 +5,7 @@ go 1.24rc1
 require (
 	github.com/RussellLuo/timingwheel v0.0.0-20220218152713-54845bda3108
 	github.com/fsnotify/fsnotify v1.8.0
+	github.com/mattn/go-isatty v0.0.19
 	github.com/pires/go-proxyproto v0.8.0
 	github.com/rs/zerolog v1.33.0
 	golang.org/x/sys v0.29.0
@@ -12,10 +13,8 @@ require (
 
 require (
 	github.com/google/uuid v1.6.0
+	github.com/pelletier/go-toml/v2 v2.2.4
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require (
-	github.com/mattn/go-colorable v0.1.13 // indirect
-	github.com/mattn/go-isatty v0.0.19 // indirect
-)
+require github.com/mattn/go-colorable v0.1.13 // indirect
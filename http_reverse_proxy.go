@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type httpDestinationKey struct{}
+
+// trackedConn stops being tracked by its destination once it is closed.
+type trackedConn struct {
+	net.Conn
+	untrack func()
+}
+
+func (c *trackedConn) Close() error {
+	c.untrack()
+	return c.Conn.Close()
+}
+
+type httpDestination struct {
+	name     string
+	dest     *Destination
+	remoteIp net.Addr
+}
+
+// serveHttp serves the front listener as an HTTP reverse proxy.
+// Every request is forwarded over its own backend connection so that
+// the PROXY header always describes the client of that request.
+func (trp *TcpReverseProxy) serveHttp(ctx context.Context, l net.Listener) error {
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = pr.In.Host
+			pr.Out.Host = pr.In.Host
+			pr.SetXForwarded()
+			if trp.liveReload != nil {
+				pr.Out.Header.Del("Accept-Encoding")
+			}
+		},
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				hd := ctx.Value(httpDestinationKey{}).(*httpDestination)
+				conn, err := trp.dialDestination(hd.dest, hd.remoteIp)
+				if err != nil {
+					return nil, err
+				}
+				return &trackedConn{Conn: conn, untrack: hd.dest.track(conn)}, nil
+			},
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			hd := r.Context().Value(httpDestinationKey{}).(*httpDestination)
+			log.Error().Err(err).Str("remote_ip", r.RemoteAddr).Str("latest_name", hd.name).Str("destination", hd.dest.addr.String()).Msg("failed to proxy request")
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	if trp.liveReload != nil {
+		proxy.ModifyResponse = trp.liveReload.Inject
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if trp.liveReload != nil && r.URL.Path == LiveReloadPath {
+			trp.liveReload.ServeHTTP(w, r)
+			return
+		}
+
+		remoteIp, err := trp.remoteAddr(r.RemoteAddr)
+		if err != nil {
+			log.Error().Err(err).Str("remote_ip", r.RemoteAddr).Msg("failed to resolve remote ip")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		latestName, dest := trp.pick()
+		if dest == nil {
+			log.Error().Str("remote_ip", r.RemoteAddr).Str("latest_name", latestName).Msg("no destination found")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		dest.sessions.Add(1)
+		defer dest.sessions.Add(-1)
+
+		ctx := context.WithValue(r.Context(), httpDestinationKey{}, &httpDestination{
+			name:     latestName,
+			dest:     dest,
+			remoteIp: remoteIp,
+		})
+		proxy.ServeHTTP(w, r.WithContext(ctx))
+	})
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       trp.config.IdleTimeout,
+	}
+
+	context.AfterFunc(ctx, func() {
+		srv.Close()
+	})
+
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
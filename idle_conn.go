@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// idleConn fails reads and writes once neither connection of a proxied pair
+// has moved any bytes for the timeout. Both sides share the activity clock,
+// so a long download does not time out the quiet upload direction.
+type idleConn struct {
+	net.Conn
+	timeout  time.Duration
+	activity *atomic.Int64
+}
+
+// withIdleTimeout wraps both connections of a pair with a shared idle timeout.
+func withIdleTimeout(timeout time.Duration, a, b net.Conn) (net.Conn, net.Conn) {
+	if timeout <= 0 {
+		return a, b
+	}
+
+	activity := &atomic.Int64{}
+	activity.Store(time.Now().UnixNano())
+
+	return &idleConn{Conn: a, timeout: timeout, activity: activity}, &idleConn{Conn: b, timeout: timeout, activity: activity}
+}
+
+func (c *idleConn) idle() bool {
+	return time.Since(time.Unix(0, c.activity.Load())) >= c.timeout
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	for {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+			return 0, err
+		}
+
+		n, err := c.Conn.Read(p)
+		if n > 0 {
+			c.activity.Store(time.Now().UnixNano())
+		}
+
+		if err != nil && errors.Is(err, os.ErrDeadlineExceeded) && !c.idle() {
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+
+		return n, err
+	}
+}
+
+func (c *idleConn) Write(p []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.activity.Store(time.Now().UnixNano())
+	}
+
+	return n, err
+}
+
+func (c *idleConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
+
+func (c *idleConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// closeWrite shuts down the writing side of conn so the peer reads EOF while
+// the other direction keeps flowing. Connections that cannot half-close are closed.
+func closeWrite(conn net.Conn) error {
+	for {
+		switch c := conn.(type) {
+		case interface{ CloseWrite() error }:
+			return c.CloseWrite()
+		case *proxyproto.Conn:
+			conn = c.Raw()
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return conn.Close()
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var InheritedListenerUnsupportedError = errors.New("listener cannot be passed as a file")
+
+// InheritedListener is a backend listener opened by revolver and handed to the
+// application as an extra file, systemd socket-activation style.
+type InheritedListener struct {
+	Name string
+	File *os.File
+}
+
+// OpenInheritedListener binds the backend address in revolver itself, so the
+// application never has to race for it, and returns a file to pass to the child.
+func OpenInheritedListener(name, network, addr string) (net.Addr, InheritedListener, error) {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, InheritedListener{}, err
+	}
+	defer l.Close()
+
+	if ul, ok := l.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+
+	fl, ok := l.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, InheritedListener{}, InheritedListenerUnsupportedError
+	}
+
+	f, err := fl.File()
+	if err != nil {
+		return nil, InheritedListener{}, err
+	}
+
+	return l.Addr(), InheritedListener{Name: name, File: f}, nil
+}
+
+// CloseInheritedListeners releases revolver's copies of the files.
+// The application keeps its own after it has been started.
+func CloseInheritedListeners(listeners []InheritedListener) {
+	for _, l := range listeners {
+		l.File.Close()
+	}
+}
+
+// inheritedListenerEnv describes the passed files to the child.
+// LISTEN_PID is filled in by listenPidCommand because the pid is unknown before start.
+func inheritedListenerEnv(listeners []InheritedListener) []string {
+	names := make([]string, 0, len(listeners))
+	for _, l := range listeners {
+		names = append(names, l.Name)
+	}
+
+	return []string{
+		"LISTEN_FDS=" + strconv.Itoa(len(listeners)),
+		"LISTEN_FDNAMES=" + strings.Join(names, ":"),
+	}
+}
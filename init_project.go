@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+var InitNoGoModuleError = errors.New("no go.mod found")
+
+// GoProject is what init learns about the module a config is written for.
+type GoProject struct {
+	ModuleDir  string
+	ModulePath string
+	// MainPackages are the absolute directories of the main packages, the module root first
+	MainPackages []string
+	// PortEnvs are the environment variables with PORT in their name that the code reads
+	PortEnvs []string
+}
+
+// InspectGoProject finds the module containing dir and its main packages and port variables.
+func InspectGoProject(dir string) (GoProject, error) {
+	project := GoProject{}
+
+	moduleDir, err := findGoMod(dir)
+	if err != nil {
+		return project, err
+	}
+	project.ModuleDir = moduleDir
+
+	data, err := os.ReadFile(filepath.Join(moduleDir, "go.mod"))
+	if err != nil {
+		return project, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			project.ModulePath = strings.Trim(strings.TrimSpace(path), `"`)
+			break
+		}
+	}
+
+	// one failing does not keep the other from proposing something
+	project.MainPackages, err = goMainPackages(moduleDir)
+	portEnvs, envErr := goPortEnvs(moduleDir)
+	project.PortEnvs = portEnvs
+
+	return project, errors.Join(err, envErr)
+}
+
+func findGoMod(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", InitNoGoModuleError
+		}
+		dir = parent
+	}
+}
+
+// goMainPackages lists the main packages of a module with go list.
+func goMainPackages(moduleDir string) ([]string, error) {
+	cmd := exec.Command("go", "list", "-e", "-f", `{{if eq .Name "main"}}{{.Dir}}{{end}}`, "./...")
+	cmd.Dir = moduleDir
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	packages := []string(nil)
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			packages = append(packages, line)
+		}
+	}
+	slices.SortStableFunc(packages, func(a, b string) int {
+		// the module root first, then by depth and name
+		if c := strings.Count(a, string(filepath.Separator)) - strings.Count(b, string(filepath.Separator)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+
+	return packages, nil
+}
+
+// goPortEnvPattern matches PORT as a whole word of the variable name, like ADMIN_PORT or PORT_HTTP,
+// but not REPORT_DIR or TRANSPORT.
+var goPortEnvPattern = regexp.MustCompile(`os\.(?:Getenv|LookupEnv)\("((?:[A-Za-z0-9]+_)*PORT(?:_[A-Za-z0-9]+)*)"\)`)
+
+// goPortEnvs finds the port variables read with os.Getenv or os.LookupEnv in the go files of a module.
+func goPortEnvs(moduleDir string) ([]string, error) {
+	envs := []string(nil)
+	err := filepath.WalkDir(moduleDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != moduleDir && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, match := range goPortEnvPattern.FindAllSubmatch(data, -1) {
+			if env := string(match[1]); !slices.Contains(envs, env) {
+				envs = append(envs, env)
+			}
+		}
+		return nil
+	})
+	slices.Sort(envs)
+
+	return envs, err
+}
+
+// portName derives the name of a port from its variable, API_PORT becomes api.
+func portName(env string) string {
+	name := strings.ToLower(env)
+	name = strings.TrimSuffix(name, "port")
+	name = strings.TrimPrefix(name, "port")
+	name = strings.Trim(name, "_")
+	if name == "" {
+		return "http"
+	}
+
+	return name
+}
+
+// prompter asks questions on a terminal, or answers them with the defaults when there is none.
+type prompter struct {
+	in          *bufio.Reader
+	out         io.Writer
+	interactive bool
+}
+
+func newPrompter(in io.Reader, out io.Writer, interactive bool) *prompter {
+	return &prompter{in: bufio.NewReader(in), out: out, interactive: interactive}
+}
+
+// isTerminal reports whether f is a terminal. Other character devices like /dev/null are not.
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+func (p *prompter) readLine() string {
+	line, _ := p.in.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// ask returns the answer to a question, def when it is left empty.
+func (p *prompter) ask(question, def string) string {
+	if !p.interactive {
+		return def
+	}
+
+	fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	if answer := p.readLine(); answer != "" {
+		return answer
+	}
+
+	return def
+}
+
+// choose returns one of the options, the first one when the answer is empty.
+// An answer that is not the number of an option is returned as it is.
+func (p *prompter) choose(question string, options []string) string {
+	if !p.interactive || len(options) == 1 {
+		return options[0]
+	}
+
+	fmt.Fprintln(p.out, question)
+	for i, option := range options {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, option)
+	}
+	fmt.Fprint(p.out, "choice [1]: ")
+
+	answer := p.readLine()
+	if answer == "" {
+		return options[0]
+	}
+	if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(options) {
+		return options[i-1]
+	}
+
+	return answer
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeGoProject(t *testing.T) string {
+	t.Helper()
+
+	return writeConfigFiles(t, map[string]string{
+		"go.mod":                   "module example.com/shop\n\ngo 1.22\n",
+		"cmd/api/main.go":          "package main\n\nfunc main() {}\n",
+		"cmd/worker/main.go":       "package main\n\nfunc main() {}\n",
+		"internal/cfg/cfg.go":      "package cfg\n\nimport \"os\"\n\nvar Port = os.Getenv(\"PORT\")\n\nvar Admin, _ = os.LookupEnv(\"ADMIN_PORT\")\n\nvar Other = []string{os.Getenv(\"REPORT_DIR\"), os.Getenv(\"TRANSPORT\"), os.Getenv(\"SUPPORT_EMAIL\"), os.Getenv(\"EXPORT_PATH\")}\n",
+		"internal/cfg/cfg_test.go": "package cfg\n\nimport \"os\"\n\nvar test = os.Getenv(\"TEST_PORT\")\n",
+	})
+}
+
+func TestInspectGoProject(t *testing.T) {
+	dir := writeGoProject(t)
+
+	project, err := InspectGoProject(filepath.Join(dir, "internal"))
+	if err != nil {
+		t.Fatalf("InspectGoProject() error = %v", err)
+	}
+	if project.ModuleDir != dir || project.ModulePath != "example.com/shop" {
+		t.Errorf("module = %s in %s, want example.com/shop in %s", project.ModulePath, project.ModuleDir, dir)
+	}
+	want := []string{filepath.Join(dir, "cmd", "api"), filepath.Join(dir, "cmd", "worker")}
+	if !slices.Equal(project.MainPackages, want) {
+		t.Errorf("main packages = %v, want %v", project.MainPackages, want)
+	}
+	if !slices.Equal(project.PortEnvs, []string{"ADMIN_PORT", "PORT"}) {
+		t.Errorf("port envs = %v, want [ADMIN_PORT PORT]", project.PortEnvs)
+	}
+}
+
+func TestInitConfig(t *testing.T) {
+	dir := writeGoProject(t)
+
+	// the worker, the race build, 9000 for ADMIN_PORT and the proposal for PORT
+	answers := "2\n2\n9000\n\n"
+	cfg := initConfig(filepath.Join(dir, "deploy"), newPrompter(strings.NewReader(answers), io.Discard, true))
+
+	if cfg.ProjectRootFolder != ".." || cfg.ExecutablePackageFolder != "../cmd/worker" {
+		t.Errorf("root = %s, exec = %s, want .. and ../cmd/worker", cfg.ProjectRootFolder, cfg.ExecutablePackageFolder)
+	}
+	wantScripts := RevolverScriptConfig{Preload: "go build -race -o worker .", Run: "./worker", CleanUp: "rm worker"}
+	if cfg.Scripts != wantScripts {
+		t.Errorf("scripts = %+v, want %+v", cfg.Scripts, wantScripts)
+	}
+	wantPorts := []RevolverPortConfig{
+		{Port: 9000, Name: "admin", Env: "ADMIN_PORT"},
+		{Port: 8081, Name: "http", Env: "PORT"},
+	}
+	if !reflect.DeepEqual(cfg.Ports, wantPorts) {
+		t.Errorf("ports = %+v, want %+v", cfg.Ports, wantPorts)
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer devNull.Close()
+
+	// /dev/null is a character device, but nothing answers prompts there
+	if isTerminal(devNull) {
+		t.Errorf("isTerminal(%s) = true, want false", os.DevNull)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if isTerminal(r) {
+		t.Errorf("isTerminal(pipe) = true, want false")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// listenPidCommand runs the command through sh so LISTEN_PID can be set to the
+// pid the command ends up with; exec keeps the shell's pid.
+func listenPidCommand(command string, args []string) (string, []string) {
+	return "/bin/sh", append([]string{"-c", `LISTEN_PID=$$; export LISTEN_PID; exec "$@"`, "revolver", command}, args...)
+}
@@ -0,0 +1,6 @@
+package main
+
+// listenPidCommand leaves the command as is, windows cannot inherit listeners.
+func listenPidCommand(command string, args []string) (string, []string) {
+	return command, args
+}
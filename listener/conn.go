@@ -0,0 +1,108 @@
+package listener
+
+import (
+	"net"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// TLV types revolver writes into the PROXY v2 header, in the range reserved for custom use.
+const (
+	// TLVTypeSessionID carries the revolver session, i.e. the deploy generation of the backend.
+	TLVTypeSessionID proxyproto.PP2Type = 0xE0
+	// TLVTypeServiceName carries the name of the port entry in the revolver config.
+	TLVTypeServiceName proxyproto.PP2Type = 0xE1
+	// TLVTypeListenerPort carries the front port the client connected to,
+	// or the socket path for unix front listeners.
+	TLVTypeListenerPort proxyproto.PP2Type = 0xE2
+)
+
+// ProxyConn unwraps conn down to the PROXY protocol connection,
+// looking through tls.Conn and other wrappers exposing NetConn.
+func ProxyConn(conn net.Conn) (*proxyproto.Conn, bool) {
+	for conn != nil {
+		switch c := conn.(type) {
+		case *proxyproto.Conn:
+			return c, true
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil, false
+		}
+	}
+
+	return nil, false
+}
+
+// Header returns the PROXY header received on conn, reading it if necessary.
+// It returns nil when the connection did not send one.
+func Header(conn net.Conn) *proxyproto.Header {
+	pc, ok := ProxyConn(conn)
+	if !ok {
+		return nil
+	}
+
+	return pc.ProxyHeader()
+}
+
+// ClientAddr returns the original client address announced in the PROXY header,
+// or the peer address when there is none.
+func ClientAddr(conn net.Conn) net.Addr {
+	if header := Header(conn); header != nil && header.SourceAddr != nil {
+		return header.SourceAddr
+	}
+
+	return conn.RemoteAddr()
+}
+
+// TLV returns the value of the first TLV of the given type in the PROXY header.
+func TLV(conn net.Conn, typ proxyproto.PP2Type) ([]byte, bool) {
+	header := Header(conn)
+	if header == nil {
+		return nil, false
+	}
+
+	tlvs, err := header.TLVs()
+	if err != nil {
+		return nil, false
+	}
+
+	for _, tlv := range tlvs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// SessionID returns the revolver session that accepted the connection.
+func SessionID(conn net.Conn) (string, bool) {
+	value, ok := TLV(conn, TLVTypeSessionID)
+	if !ok {
+		return "", false
+	}
+
+	return string(value), true
+}
+
+// ServiceName returns the name of the revolver port entry the connection was routed through.
+func ServiceName(conn net.Conn) (string, bool) {
+	value, ok := TLV(conn, TLVTypeServiceName)
+	if !ok {
+		return "", false
+	}
+
+	return string(value), true
+}
+
+// ListenerPort returns the revolver front port the client connected to.
+// For unix front listeners it is the socket path.
+func ListenerPort(conn net.Conn) (string, bool) {
+	value, ok := TLV(conn, TLVTypeListenerPort)
+	if !ok {
+		return "", false
+	}
+
+	return string(value), true
+}
@@ -0,0 +1,68 @@
+package listener
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+type connContextKey struct{}
+
+// ConnInfo describes the client and the revolver front end behind a connection.
+type ConnInfo struct {
+	ClientAddr   net.Addr
+	SessionID    string
+	ServiceName  string
+	ListenerPort string
+}
+
+// ConnContext stores the connection in the context, use it as http.Server.ConnContext.
+// The PROXY header is read lazily by ConnInfoFromContext, because net/http calls
+// ConnContext from its accept loop.
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+// ConnInfoFromContext returns the client address and the PROXY TLVs of the connection
+// a request arrived on. It requires the server to use ConnContext.
+func ConnInfoFromContext(ctx context.Context) (ConnInfo, bool) {
+	conn, ok := ctx.Value(connContextKey{}).(net.Conn)
+	if !ok {
+		return ConnInfo{}, false
+	}
+
+	info := ConnInfo{
+		ClientAddr: ClientAddr(conn),
+	}
+	info.SessionID, _ = SessionID(conn)
+	info.ServiceName, _ = ServiceName(conn)
+	info.ListenerPort, _ = ListenerPort(conn)
+
+	return info, true
+}
+
+// Middleware sets Request.RemoteAddr to the client address from the PROXY header.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := ConnInfoFromContext(r.Context()); ok && info.ClientAddr != nil {
+			r.RemoteAddr = info.ClientAddr.String()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewHTTPServer returns an http.Server wired with ConnContext and Middleware,
+// so handlers see the real client address and ConnInfoFromContext works.
+// Serve it on a listener from New, NewUnix or Inherited.
+func NewHTTPServer(handler http.Handler) *http.Server {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	return &http.Server{
+		Handler:           Middleware(handler),
+		ConnContext:       ConnContext,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
@@ -0,0 +1,61 @@
+package listener
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestNewHTTPServer(t *testing.T) {
+	lis, err := New("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	srv := NewHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, ok := ConnInfoFromContext(r.Context())
+		if !ok {
+			t.Errorf("ConnInfoFromContext() ok = false")
+		}
+		fmt.Fprintf(w, "%s %s %s %s", r.RemoteAddr, info.SessionID, info.ServiceName, info.ListenerPort)
+	}))
+	go srv.Serve(lis)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	header := proxyproto.HeaderProxyFromAddrs(2, &net.TCPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 4321}, &net.TCPAddr{IP: net.IPv4(0, 0, 0, 0), Port: 8080})
+	if err := header.SetTLVs([]proxyproto.TLV{
+		{Type: TLVTypeSessionID, Value: []byte("session")},
+		{Type: TLVTypeServiceName, Value: []byte("http")},
+		{Type: TLVTypeListenerPort, Value: []byte("8080")},
+	}); err != nil {
+		t.Fatalf("SetTLVs() error = %v", err)
+	}
+	if _, err := header.WriteTo(conn); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example\r\nConnection: close\r\n\r\n"); err != nil {
+		t.Fatalf("WriteString() error = %v", err)
+	}
+
+	resp, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+
+	want := "203.0.113.7:4321 session http 8080"
+	if !strings.HasSuffix(string(resp), want) {
+		t.Errorf("response = %q, want suffix %q", resp, want)
+	}
+}
@@ -0,0 +1,56 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ListenFdsStart is the first inherited file descriptor, after stdin, stdout and stderr.
+const ListenFdsStart = 3
+
+var NotInheritedError = errors.New("listener was not inherited")
+
+// Inherited adopts a listener passed by revolver (or systemd) through LISTEN_FDS,
+// LISTEN_FDNAMES and LISTEN_PID, and wraps it like New.
+// It returns NotInheritedError when no listener with the name was passed,
+// so callers can fall back to New.
+func Inherited(name string, opt ...func(*Config)) (net.Listener, error) {
+	fd, err := inheritedFd(name, os.Getenv, os.Getpid())
+	if err != nil {
+		return nil, err
+	}
+
+	f := os.NewFile(fd, name)
+	lis, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to adopt inherited listener %s: %w", name, err)
+	}
+
+	return wrap(lis, opt...)
+}
+
+// inheritedFd finds the file descriptor passed for name in the LISTEN_* variables of getenv.
+func inheritedFd(name string, getenv func(string) string, pid int) (uintptr, error) {
+	if listenPid := getenv("LISTEN_PID"); listenPid != "" && listenPid != strconv.Itoa(pid) {
+		return 0, NotInheritedError
+	}
+
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return 0, NotInheritedError
+	}
+
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < count && i < len(names); i++ {
+		if names[i] == name {
+			return uintptr(ListenFdsStart + i), nil
+		}
+	}
+
+	return 0, NotInheritedError
+}
@@ -0,0 +1,63 @@
+package listener
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInheritedFd(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want uintptr
+		err  error
+	}{
+		{
+			name: "first",
+			env:  map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "2", "LISTEN_FDNAMES": "http:admin"},
+			want: 3,
+		},
+		{
+			name: "second",
+			env:  map[string]string{"LISTEN_FDS": "2", "LISTEN_FDNAMES": "admin:http"},
+			want: 4,
+		},
+		{
+			name: "other process",
+			env:  map[string]string{"LISTEN_PID": "7", "LISTEN_FDS": "1", "LISTEN_FDNAMES": "http"},
+			err:  NotInheritedError,
+		},
+		{
+			name: "not passed",
+			env:  map[string]string{"LISTEN_FDS": "1", "LISTEN_FDNAMES": "admin"},
+			err:  NotInheritedError,
+		},
+		{
+			name: "name beyond count",
+			env:  map[string]string{"LISTEN_FDS": "1", "LISTEN_FDNAMES": "admin:http"},
+			err:  NotInheritedError,
+		},
+		{
+			name: "invalid count",
+			env:  map[string]string{"LISTEN_FDS": "two", "LISTEN_FDNAMES": "http"},
+			err:  NotInheritedError,
+		},
+		{
+			name: "no env",
+			env:  map[string]string{},
+			err:  NotInheritedError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inheritedFd("http", func(key string) string { return tt.env[key] }, 42)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("inheritedFd() error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("inheritedFd() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
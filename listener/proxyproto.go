@@ -1,20 +1,183 @@
 package listener
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"net"
+	"os"
+	"time"
 
 	"github.com/pires/go-proxyproto"
 )
 
-func New(addr string) (net.Listener, error) {
+var NotSocketError = errors.New("address in use by a file that is not a socket")
+
+type Config struct {
+	Policy           proxyproto.Policy
+	TrustedUpstreams []string
+	HeaderTimeout    time.Duration
+	TlsConfig        *tls.Config
+}
+
+// WithPolicy sets how the PROXY header is treated, e.g. proxyproto.REQUIRE
+// to refuse connections that did not come through revolver.
+// The default is proxyproto.USE, which accepts connections with or without the header.
+func WithPolicy(policy proxyproto.Policy) func(*Config) {
+	return func(c *Config) {
+		c.Policy = policy
+	}
+}
+
+// WithTrustedUpstreams only accepts connections from the given IPs or CIDRs.
+// Connections from any other source are closed before the header is read.
+func WithTrustedUpstreams(upstreams ...string) func(*Config) {
+	return func(c *Config) {
+		c.TrustedUpstreams = append(c.TrustedUpstreams, upstreams...)
+	}
+}
+
+// WithHeaderTimeout limits how long a new connection may take to send its PROXY header.
+func WithHeaderTimeout(timeout time.Duration) func(*Config) {
+	return func(c *Config) {
+		c.HeaderTimeout = timeout
+	}
+}
+
+// WithTLS terminates TLS after the PROXY header, for ports routed by SNI.
+func WithTLS(cfg *tls.Config) func(*Config) {
+	return func(c *Config) {
+		c.TlsConfig = cfg
+	}
+}
+
+func New(addr string, opt ...func(*Config)) (net.Listener, error) {
 	lis, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
 
-	proxyListener := proxyproto.Listener{
-		Listener: lis,
+	return wrap(lis, opt...)
+}
+
+// NewUnix listens on a unix socket path, e.g. the one revolver passes
+// through the port env when a port uses `backend: unix`.
+func NewUnix(path string, opt ...func(*Config)) (net.Listener, error) {
+	if err := RemoveStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrap(lis, opt...)
+}
+
+// RemoveStaleSocket removes the socket a previous run left at path, so it can be listened on again.
+// Anything else at path is left alone and reported as NotSocketError.
+func RemoveStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s: %w", path, NotSocketError)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func wrap(lis net.Listener, opt ...func(*Config)) (net.Listener, error) {
+	cfg := &Config{
+		Policy: proxyproto.USE,
+	}
+	for _, o := range opt {
+		o(cfg)
+	}
+
+	proxyListener := &proxyproto.Listener{
+		Listener:          lis,
+		ReadHeaderTimeout: cfg.HeaderTimeout,
+	}
+
+	if len(cfg.TrustedUpstreams) > 0 {
+		trusted, err := parseUpstreams(cfg.TrustedUpstreams)
+		if err != nil {
+			lis.Close()
+			return nil, err
+		}
+
+		proxyListener.ConnPolicy = func(options proxyproto.ConnPolicyOptions) (proxyproto.Policy, error) {
+			if isTrusted(trusted, options.Upstream) {
+				return cfg.Policy, nil
+			}
+			return proxyproto.REJECT, proxyproto.ErrInvalidUpstream
+		}
+	} else if cfg.Policy != proxyproto.USE {
+		proxyListener.ConnPolicy = func(proxyproto.ConnPolicyOptions) (proxyproto.Policy, error) {
+			return cfg.Policy, nil
+		}
+	}
+
+	if cfg.TlsConfig != nil {
+		return tls.NewListener(proxyListener, cfg.TlsConfig), nil
+	}
+
+	return proxyListener, nil
+}
+
+func parseUpstreams(upstreams []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		if _, ipNet, err := net.ParseCIDR(upstream); err == nil {
+			nets = append(nets, ipNet)
+			continue
+		}
+
+		ip := net.ParseIP(upstream)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid trusted upstream %q", upstream)
+		}
+
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 8 * net.IPv4len
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+
+	return nets, nil
+}
+
+// isTrusted treats unix socket peers as trusted, since access is already
+// limited by the socket file permissions.
+func isTrusted(trusted []*net.IPNet, upstream net.Addr) bool {
+	var ip net.IP
+	switch addr := upstream.(type) {
+	case *net.TCPAddr:
+		ip = addr.IP
+	case *net.UnixAddr:
+		return true
+	default:
+		return false
+	}
+
+	for _, ipNet := range trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
 	}
 
-	return &proxyListener, nil
+	return false
 }
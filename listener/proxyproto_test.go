@@ -0,0 +1,135 @@
+package listener
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestTrustedUpstreams(t *testing.T) {
+	client := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4321}
+
+	tests := []struct {
+		name   string
+		opt    []func(*Config)
+		header bool
+		// want is the client address the server sees, empty when the connection is refused
+		want string
+	}{
+		{name: "header", header: true, want: client.String()},
+		{name: "no header", want: "127.0.0.1"},
+		{name: "required header missing", opt: []func(*Config){WithPolicy(proxyproto.REQUIRE)}},
+		{name: "trusted ip", opt: []func(*Config){WithTrustedUpstreams("127.0.0.1")}, header: true, want: client.String()},
+		{name: "trusted cidr", opt: []func(*Config){WithTrustedUpstreams("10.0.0.0/8", "127.0.0.0/8")}, header: true, want: client.String()},
+		{name: "untrusted", opt: []func(*Config){WithTrustedUpstreams("10.0.0.0/8")}, header: true},
+		{name: "trusted with required header missing", opt: []func(*Config){WithTrustedUpstreams("127.0.0.1"), WithPolicy(proxyproto.REQUIRE)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lis, err := New("127.0.0.1:0", tt.opt...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer lis.Close()
+
+			go func() {
+				conn, err := lis.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+					return
+				}
+				addr := ClientAddr(conn).String()
+				if tcpAddr, ok := ClientAddr(conn).(*net.TCPAddr); ok && tcpAddr.Port != client.Port {
+					// the peer port is random, only its ip is compared
+					addr = tcpAddr.IP.String()
+				}
+				conn.Write([]byte(addr))
+			}()
+
+			conn, err := net.Dial("tcp", lis.Addr().String())
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+			if tt.header {
+				if _, err := proxyproto.HeaderProxyFromAddrs(2, client, lis.Addr()).WriteTo(conn); err != nil {
+					t.Fatalf("WriteTo() error = %v", err)
+				}
+			}
+			conn.Write([]byte("ping"))
+
+			got, _ := io.ReadAll(conn)
+			if string(got) != tt.want {
+				t.Errorf("client address = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidTrustedUpstream(t *testing.T) {
+	if lis, err := New("127.0.0.1:0", WithTrustedUpstreams("not-an-ip")); err == nil {
+		lis.Close()
+		t.Errorf("New() error = nil, want an error for an invalid upstream")
+	}
+}
+
+func TestNewUnix(t *testing.T) {
+	dir, err := os.MkdirTemp("", "listener")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("stale socket", func(t *testing.T) {
+		path := filepath.Join(dir, "stale.sock")
+		stale, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatalf("Listen() error = %v", err)
+		}
+		// keep the socket file behind, like a run that was killed
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+
+		lis, err := NewUnix(path)
+		if err != nil {
+			t.Fatalf("NewUnix() error = %v", err)
+		}
+		defer lis.Close()
+
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		conn.Close()
+	})
+
+	t.Run("regular file", func(t *testing.T) {
+		path := filepath.Join(dir, "file.sock")
+		if err := os.WriteFile(path, []byte("keep"), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+
+		if lis, err := NewUnix(path); !errors.Is(err, NotSocketError) {
+			if lis != nil {
+				lis.Close()
+			}
+			t.Fatalf("NewUnix() error = %v, want %v", err, NotSocketError)
+		}
+
+		if data, err := os.ReadFile(path); err != nil || string(data) != "keep" {
+			t.Errorf("file = %q, %v, want it left alone", data, err)
+		}
+	})
+}
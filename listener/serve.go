@@ -0,0 +1,111 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// NotifySocketEnv names the env holding the datagram socket revolver listens on for state updates.
+const NotifySocketEnv = "NOTIFY_SOCKET"
+
+type ServeConfig struct {
+	ShutdownTimeout time.Duration
+	Signals         []os.Signal
+}
+
+// WithShutdownTimeout limits how long in-flight requests may take after a stop signal.
+// Connections still open afterward are closed.
+func WithShutdownTimeout(timeout time.Duration) func(*ServeConfig) {
+	return func(c *ServeConfig) {
+		c.ShutdownTimeout = timeout
+	}
+}
+
+// WithSignals replaces the signals that start a graceful shutdown.
+func WithSignals(signals ...os.Signal) func(*ServeConfig) {
+	return func(c *ServeConfig) {
+		c.Signals = signals
+	}
+}
+
+// Notify sends state lines such as "READY=1", "STOPPING=1" or "STATUS=..." to the
+// socket in NOTIFY_SOCKET, in the sd_notify format. It does nothing when the env is unset.
+func Notify(state ...string) error {
+	path := os.Getenv(NotifySocketEnv)
+	if path == "" {
+		return nil
+	}
+
+	// a leading @ denotes a socket in the linux abstract namespace
+	if strings.HasPrefix(path, "@") {
+		path = "\x00" + path[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(strings.Join(state, "\n"))); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Serve runs srv on lis and reports READY=1 to revolver once it accepts connections.
+// On SIGTERM or interrupt, or when ctx is done, it reports STOPPING=1, stops accepting
+// and waits for in-flight requests up to the shutdown timeout before closing the rest.
+// Hijacked connections such as websockets are not waited for.
+func Serve(ctx context.Context, srv *http.Server, lis net.Listener, opt ...func(*ServeConfig)) error {
+	cfg := &ServeConfig{
+		ShutdownTimeout: 10 * time.Second,
+		Signals:         []os.Signal{syscall.SIGTERM, os.Interrupt},
+	}
+	for _, o := range opt {
+		o(cfg)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, cfg.Signals...)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(lis)
+	}()
+
+	// readiness is best effort, a lost notification must not stop the server
+	Notify("READY=1")
+
+	select {
+	case err := <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	Notify("STOPPING=1")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package listener
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServeShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		name            string
+		requestTime     time.Duration
+		shutdownTimeout time.Duration
+		wantBody        string
+	}{
+		{name: "in-flight request finishes", requestTime: 200 * time.Millisecond, shutdownTimeout: 2 * time.Second, wantBody: "done"},
+		{name: "request outlives the timeout", requestTime: 5 * time.Second, shutdownTimeout: 200 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notify, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(t.TempDir(), "notify.sock"), Net: "unixgram"})
+			if err != nil {
+				t.Fatalf("ListenUnixgram() error = %v", err)
+			}
+			defer notify.Close()
+			t.Setenv(NotifySocketEnv, notify.LocalAddr().String())
+
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Listen() error = %v", err)
+			}
+
+			started := make(chan struct{})
+			srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				select {
+				case <-time.After(tt.requestTime):
+					w.Write([]byte("done"))
+				case <-r.Context().Done():
+				}
+			})}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			served := make(chan error, 1)
+			go func() {
+				served <- Serve(ctx, srv, lis, WithShutdownTimeout(tt.shutdownTimeout))
+			}()
+
+			body := make(chan string, 1)
+			go func() {
+				resp, err := http.Get("http://" + lis.Addr().String())
+				if err != nil {
+					body <- ""
+					return
+				}
+				defer resp.Body.Close()
+				data, _ := io.ReadAll(resp.Body)
+				body <- string(data)
+			}()
+
+			<-started
+			stopped := time.Now()
+			cancel()
+
+			select {
+			case err := <-served:
+				if err != nil {
+					t.Errorf("Serve() error = %v", err)
+				}
+			case <-time.After(tt.shutdownTimeout + time.Second):
+				t.Fatalf("Serve() did not return within the shutdown timeout")
+			}
+			if elapsed := time.Since(stopped); elapsed > tt.shutdownTimeout+500*time.Millisecond {
+				t.Errorf("Serve() returned after %s, want at most %s", elapsed, tt.shutdownTimeout)
+			}
+
+			if got := <-body; got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+
+			for _, want := range []string{"READY=1", "STOPPING=1"} {
+				notify.SetReadDeadline(time.Now().Add(time.Second))
+				buf := make([]byte, 64)
+				n, err := notify.Read(buf)
+				if err != nil || string(buf[:n]) != want {
+					t.Errorf("notification = %q, %v, want %q", buf[:n], err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LiveReloadPath        = "/__revolver/livereload"
+	LiveReloadWaitTimeout = 5 * time.Minute
+)
+
+const liveReloadScript = `<script>(function(){var s=new EventSource("` + LiveReloadPath + `");s.addEventListener("reload",function(){s.close();location.reload();});})();</script>`
+
+// LiveReload keeps track of the browser tabs subscribed over server-sent events
+// and tells them to refresh when a new destination becomes current.
+type LiveReload struct {
+	clients     map[chan struct{}]struct{}
+	clientsLock sync.Mutex
+}
+
+func NewLiveReload() *LiveReload {
+	return &LiveReload{
+		clients: make(map[chan struct{}]struct{}),
+	}
+}
+
+// Reload signals every subscribed tab to refresh.
+func (lr *LiveReload) Reload() {
+	lr.clientsLock.Lock()
+	defer lr.clientsLock.Unlock()
+	for ch := range lr.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (lr *LiveReload) subscribe() chan struct{} {
+	ch := make(chan struct{}, 1)
+	lr.clientsLock.Lock()
+	lr.clients[ch] = struct{}{}
+	lr.clientsLock.Unlock()
+	return ch
+}
+
+func (lr *LiveReload) unsubscribe(ch chan struct{}) {
+	lr.clientsLock.Lock()
+	delete(lr.clients, ch)
+	lr.clientsLock.Unlock()
+}
+
+// ServeHTTP streams reload events to a browser tab.
+func (lr *LiveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ch := lr.subscribe()
+	defer lr.unsubscribe(ch)
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ch:
+			fmt.Fprint(w, "event: reload\ndata: {}\n\n")
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Inject inserts the live-reload script into a text/html response body.
+// Compressed bodies are left untouched.
+func (lr *LiveReload) Inject(resp *http.Response) error {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return nil
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read html body: %w", err)
+	}
+
+	body = injectLiveReloadScript(body)
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	return nil
+}
+
+func injectLiveReloadScript(body []byte) []byte {
+	tag := []byte("</body>")
+	idx := -1
+	for i := len(body) - len(tag); i >= 0; i-- {
+		if bytes.EqualFold(body[i:i+len(tag)], tag) {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return append(body, liveReloadScript...)
+	}
+
+	injected := make([]byte, 0, len(body)+len(liveReloadScript))
+	injected = append(injected, body[:idx]...)
+	injected = append(injected, liveReloadScript...)
+	injected = append(injected, body[idx:]...)
+	return injected
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInjectLiveReloadScript(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "before closing body",
+			body: "<html><body>hi</body></html>",
+			want: "<html><body>hi" + liveReloadScript + "</body></html>",
+		},
+		{
+			name: "case insensitive",
+			body: "<HTML><BODY>hi</BODY></HTML>",
+			want: "<HTML><BODY>hi" + liveReloadScript + "</BODY></HTML>",
+		},
+		{
+			name: "last closing body",
+			body: "<body><pre></body></pre></body>",
+			want: "<body><pre></body></pre>" + liveReloadScript + "</body>",
+		},
+		{
+			name: "no closing body",
+			body: "<p>fragment</p>",
+			want: "<p>fragment</p>" + liveReloadScript,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(injectLiveReloadScript([]byte(tt.body))); got != tt.want {
+				t.Errorf("injectLiveReloadScript() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLiveReloadInject(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		injected    bool
+	}{
+		{name: "html", contentType: "text/html; charset=utf-8", injected: true},
+		{name: "json", contentType: "application/json"},
+		{name: "compressed html", contentType: "text/html", encoding: "gzip"},
+	}
+
+	body := "<html><body></body></html>"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				Header:        http.Header{"Content-Type": {tt.contentType}},
+				Body:          io.NopCloser(strings.NewReader(body)),
+				ContentLength: int64(len(body)),
+			}
+			if tt.encoding != "" {
+				resp.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			if err := NewLiveReload().Inject(resp); err != nil {
+				t.Fatalf("Inject() error = %v", err)
+			}
+
+			got, _ := io.ReadAll(resp.Body)
+			if injected := strings.Contains(string(got), liveReloadScript); injected != tt.injected {
+				t.Errorf("Inject() body = %q, want injected %v", got, tt.injected)
+			}
+			if resp.ContentLength != int64(len(got)) {
+				t.Errorf("ContentLength = %d, want %d", resp.ContentLength, len(got))
+			}
+			if tt.injected && resp.Header.Get("Content-Length") != strconv.Itoa(len(got)) {
+				t.Errorf("Content-Length = %s, want %d", resp.Header.Get("Content-Length"), len(got))
+			}
+		})
+	}
+}
+
+func TestLiveReloadEvents(t *testing.T) {
+	lr := NewLiveReload()
+	srv := httptest.NewServer(lr)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %s, want text/event-stream", got)
+	}
+
+	// the headers are flushed before the tab subscribes
+	for i := 0; ; i++ {
+		lr.clientsLock.Lock()
+		subscribed := len(lr.clients)
+		lr.clientsLock.Unlock()
+		if subscribed == 1 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("subscribed tabs = %d, want 1", subscribed)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	lr.Reload()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("stream closed before the reload event")
+			}
+			if line == "event: reload" {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no reload event")
+		}
+	}
+}
+
+func TestTcpReverseProxyUnknownMode(t *testing.T) {
+	rp := NewTcpReverseProxy("127.0.0.1:0", WithProxyMode("udp"))
+	err := rp.Start(context.Background())
+	if !errors.Is(err, TcpReverseProxyUnknownModeError) {
+		t.Errorf("Start() error = %v, want %v", err, TcpReverseProxyUnknownModeError)
+	}
+}
@@ -20,19 +20,7 @@ const (
 )
 
 func Init(level LogLevel) {
-	zerologLevel := zerolog.InfoLevel
-	switch level {
-	case LogLevelDebug:
-		zerologLevel = zerolog.DebugLevel
-	case LogLevelInfo:
-		zerologLevel = zerolog.InfoLevel
-	case LogLevelWarn:
-		zerologLevel = zerolog.WarnLevel
-	case LogLevelError:
-		zerologLevel = zerolog.ErrorLevel
-	default:
-		zerologLevel = zerolog.InfoLevel
-	}
+	SetLogLevel(level)
 
 	zerolog.TimeFieldFormat = time.RFC3339Nano
 	output := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339Nano}
@@ -48,5 +36,24 @@ func Init(level LogLevel) {
 	output.FormatFieldValue = func(i interface{}) string {
 		return fmt.Sprintf("%s", i)
 	}
-	log.Logger = zerolog.New(output).Level(zerologLevel).With().Timestamp().Logger()
+	log.Logger = zerolog.New(output).With().Timestamp().Logger()
+}
+
+// SetLogLevel changes the level of the logger, also while it is in use.
+func SetLogLevel(level LogLevel) {
+	zerologLevel := zerolog.InfoLevel
+	switch level {
+	case LogLevelDebug:
+		zerologLevel = zerolog.DebugLevel
+	case LogLevelInfo:
+		zerologLevel = zerolog.InfoLevel
+	case LogLevelWarn:
+		zerologLevel = zerolog.WarnLevel
+	case LogLevelError:
+		zerologLevel = zerolog.ErrorLevel
+	default:
+		zerologLevel = zerolog.InfoLevel
+	}
+
+	zerolog.SetGlobalLevel(zerologLevel)
 }
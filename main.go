@@ -3,31 +3,38 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Printf("Usage: %s <Command>", os.Args[0])
-		return
+	// without a command revolver watches, so flags may come first: revolver --profile debug
+	command, args := CommandWatch, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
 
-	command := os.Args[1]
-	args := os.Args[2:]
-
+	err := error(nil)
 	switch command {
 	case CommandInit:
 		Init(LogLevelDebug)
-		if err := CommandInitFunc(args); err != nil {
-			log.Error().Err(err).Strs("args", args).Msg("failed to run command")
-		}
+		err = CommandInitFunc(args)
+	case CommandValidate:
+		err = CommandValidateFunc(args)
+	case CommandSchema:
+		err = CommandSchemaFunc(args)
 	case CommandWatch:
-		if err := CommandWatchFunc(args); err != nil {
-			log.Error().Err(err).Strs("args", args).Msg("failed to run command")
-		}
+		err = CommandWatchFunc(args)
 	default:
-		log.Error().Str("command", command).Msg("unknown command")
+		fmt.Printf("Usage: %s [init|validate|schema|watch] [flags]\n", os.Args[0])
+		err = fmt.Errorf("%w: %s", CommandUnknownError, command)
+	}
+
+	// every failed command exits non-zero, so scripts and CI notice
+	if err != nil {
+		log.Error().Err(err).Str("command", command).Strs("args", args).Msg("failed to run command")
+		os.Exit(1)
 	}
 
 	//log.Info().Str("project_path", projectPath).Str("cmd_path", cmdPath).Strs("exts", exts).Msg("checking arguments")
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const DefaultReadyTimeout = 60 * time.Second
+
+var (
+	NotifySocketTimeoutError = errors.New("timed out waiting for READY=1")
+	NotifySocketExitedError  = errors.New("runnable exited before READY=1")
+)
+
+// NotifySocket receives sd_notify style state lines from the application:
+// READY=1 once it accepts connections, STOPPING=1 when it begins shutting down
+// and STATUS=... with free-form text. Its path is exported as NOTIFY_SOCKET.
+type NotifySocket struct {
+	session   string
+	path      string
+	conn      *net.UnixConn
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+func NewNotifySocket(session string) (*NotifySocket, error) {
+	path, err := GetFreeUnixSocket(session, "notify")
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	ns := &NotifySocket{
+		session: session,
+		path:    path,
+		conn:    conn,
+		ready:   make(chan struct{}),
+	}
+	go ns.serve()
+
+	return ns, nil
+}
+
+func (ns *NotifySocket) Path() string {
+	return ns.path
+}
+
+// Ready is closed when the application has sent READY=1.
+func (ns *NotifySocket) Ready() <-chan struct{} {
+	return ns.ready
+}
+
+func (ns *NotifySocket) Close() error {
+	err := ns.conn.Close()
+	os.Remove(ns.path)
+	return err
+}
+
+func (ns *NotifySocket) serve() {
+	buf := make([]byte, 4096)
+	for {
+		n, _, err := ns.conn.ReadFromUnix(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Error().Err(err).Str("session", ns.session).Msg("failed to read notify socket")
+			}
+			return
+		}
+
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			key, value, _ := strings.Cut(line, "=")
+			switch key {
+			case "READY":
+				if value == "1" {
+					ns.readyOnce.Do(func() {
+						log.Info().Str("session", ns.session).Msg("runnable is ready")
+						close(ns.ready)
+					})
+				}
+			case "STOPPING":
+				if value == "1" {
+					log.Info().Str("session", ns.session).Msg("runnable is stopping")
+				}
+			case "STATUS":
+				log.Info().Str("session", ns.session).Str("status", value).Msg("runnable status")
+			}
+		}
+	}
+}
+
+// WaitReady blocks until READY=1 arrives. It fails when the timeout passes,
+// when ctx is done, or as soon as alive reports that the application has exited.
+func (ns *NotifySocket) WaitReady(ctx context.Context, timeout time.Duration, alive func() bool) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ns.ready:
+			return nil
+		case <-timer.C:
+			return NotifySocketTimeoutError
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if !alive() {
+				return NotifySocketExitedError
+			}
+		}
+	}
+}
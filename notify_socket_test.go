@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNotifySocketWaitReady(t *testing.T) {
+	tests := []struct {
+		name    string
+		send    []string
+		exited  bool
+		cancel  bool
+		timeout time.Duration
+		err     error
+	}{
+		{name: "ready", send: []string{"STATUS=warming up\nREADY=1"}, timeout: 5 * time.Second},
+		{name: "ready in a later message", send: []string{"STATUS=loading", "READY=1"}, timeout: 5 * time.Second},
+		{name: "timeout", send: []string{"READY=0"}, timeout: 300 * time.Millisecond, err: NotifySocketTimeoutError},
+		{name: "dead process", exited: true, timeout: 5 * time.Second, err: NotifySocketExitedError},
+		{name: "canceled", cancel: true, timeout: 5 * time.Second, err: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := NewSession()
+			if err != nil {
+				t.Fatalf("NewSession() error = %v", err)
+			}
+			ns, err := NewNotifySocket(session)
+			if err != nil {
+				t.Fatalf("NewNotifySocket() error = %v", err)
+			}
+			defer ns.Close()
+
+			conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: ns.Path(), Net: "unixgram"})
+			if err != nil {
+				t.Fatalf("DialUnix() error = %v", err)
+			}
+			defer conn.Close()
+			for _, msg := range tt.send {
+				if _, err := conn.Write([]byte(msg)); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			started := time.Now()
+			err = ns.WaitReady(ctx, tt.timeout, func() bool { return !tt.exited })
+			if !errors.Is(err, tt.err) {
+				t.Errorf("WaitReady() error = %v, want %v", err, tt.err)
+			}
+			if tt.exited && time.Since(started) >= tt.timeout {
+				t.Errorf("WaitReady() took %s, want to return as soon as the process is gone", time.Since(started))
+			}
+		})
+	}
+}
@@ -9,12 +9,24 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// RunnableExit describes how a runnable ended.
+type RunnableExit struct {
+	Err error
+	// Code is the exit code of the last command, or -1 when it did not exit on its own.
+	Code int
+	// Canceled reports that revolver stopped the runnable.
+	Canceled bool
+	At       time.Time
+}
+
 type Runnable struct {
 	path        string
 	isRunning   atomic.Bool
 	initialized atomic.Bool
 	cancel      context.CancelFunc
 	scriptSet   RevolverScriptConfig
+	done        chan struct{}
+	exit        atomic.Pointer[RunnableExit]
 }
 
 func (r *Runnable) IsRunning() bool {
@@ -25,10 +37,26 @@ func (r *Runnable) IsInitialized() bool {
 	return r.initialized.Load()
 }
 
+// Done is closed when the runnable has ended, see Exit for how.
+func (r *Runnable) Done() <-chan struct{} {
+	return r.done
+}
+
+// Exit returns how the runnable ended, or false while it is still running.
+func (r *Runnable) Exit() (RunnableExit, bool) {
+	exit := r.exit.Load()
+	if exit == nil {
+		return RunnableExit{}, false
+	}
+
+	return *exit, true
+}
+
 func NewRunnable(path string, script RevolverScriptConfig) *Runnable {
 	return &Runnable{
 		path:      path,
 		scriptSet: script,
+		done:      make(chan struct{}),
 	}
 }
 
@@ -45,16 +73,27 @@ func (r *Runnable) Start(ctx context.Context, env []string, f func(context.Conte
 	r.cancel = cancel
 
 	go func() {
+		defer close(r.done)
 		defer r.isRunning.Store(false)
 		r.initialized.Store(true)
 		r.isRunning.Store(true)
+
+		exit := &RunnableExit{Code: -1}
+		defer func() {
+			exit.Canceled = ctx.Err() != nil
+			exit.At = time.Now()
+			r.exit.Store(exit)
+		}()
+
 		if err := f(ctx, env, r.path, r.scriptSet); err != nil {
+			exit.Err = err
 			type ExitError interface {
 				ExitCode() int
 				Exited() bool
 				Error() string
 			}
-			if errors.As(err, new(ExitError)) {
+			if exitErr := ExitError(nil); errors.As(err, &exitErr) {
+				exit.Code = exitErr.ExitCode()
 				log.Debug().Err(err).Msg("failed to run command")
 				return
 			}
@@ -63,7 +102,9 @@ func (r *Runnable) Start(ctx context.Context, env []string, f func(context.Conte
 				return
 			}
 			log.Error().Err(err).Msg("stopped runnable")
+			return
 		}
+		exit.Code = 0
 	}()
 
 	return true
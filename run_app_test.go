@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRunnableExit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	tests := []struct {
+		run      string
+		cancel   bool
+		code     int
+		canceled bool
+	}{
+		{run: "true", code: 0},
+		{run: "sh -c \"exit 3\"", code: 3},
+		{run: "sleep 10", cancel: true, code: -1, canceled: true},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.run, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			r := NewRunnable(dir, RevolverScriptConfig{Preload: "true", Run: tt.run, CleanUp: "true"})
+			if !r.Start(ctx, nil, RunCommandSet) {
+				t.Fatalf("Start() = false")
+			}
+
+			if tt.cancel {
+				time.Sleep(100 * time.Millisecond)
+				if _, ok := r.Exit(); ok {
+					t.Errorf("Exit() ok = true while running")
+				}
+				cancel()
+			}
+
+			select {
+			case <-r.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Done() was not closed")
+			}
+
+			exit, ok := r.Exit()
+			if !ok {
+				t.Fatalf("Exit() ok = false after Done()")
+			}
+			if exit.Code != tt.code {
+				t.Errorf("Exit().Code = %d, want %d", exit.Code, tt.code)
+			}
+			if exit.Canceled != tt.canceled {
+				t.Errorf("Exit().Canceled = %v, want %v", exit.Canceled, tt.canceled)
+			}
+		})
+	}
+}
@@ -7,18 +7,49 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
+const DefaultStopTimeout = 10 * time.Second
+
 func runCommand(ctx context.Context, env []string, path string, command string, args ...string) error {
+	return runCommandWithListeners(ctx, env, nil, 0, path, command, args...)
+}
+
+// runCommandWithListeners passes the listeners as extra files starting at fd 3.
+// revolver's copies are closed as soon as the child has been started.
+// With a stopTimeout the child is asked to terminate when ctx is done and only
+// killed if it is still running after the timeout.
+func runCommandWithListeners(ctx context.Context, env []string, listeners []InheritedListener, stopTimeout time.Duration, path string, command string, args ...string) error {
+	if len(listeners) > 0 {
+		command, args = listenPidCommand(command, args)
+		env = append(env[:len(env):len(env)], inheritedListenerEnv(listeners)...)
+	}
+
 	cmd := exec.CommandContext(ctx, command, args...)
 	cmd.Dir = path
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Env = env
+	for _, l := range listeners {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, l.File)
+	}
+	if stopTimeout > 0 {
+		cmd.Cancel = func() error {
+			return terminateProcess(cmd.Process)
+		}
+		cmd.WaitDelay = stopTimeout
+	}
+
+	err := cmd.Start()
+	CloseInheritedListeners(listeners)
+	if err != nil {
+		return err
+	}
 
-	if err := cmd.Run(); err != nil {
+	if err := cmd.Wait(); err != nil {
 		return err
 	}
 
@@ -39,6 +70,19 @@ func ParseCommand(content string) ([]string, error) {
 }
 
 func RunCommandSet(ctx context.Context, env []string, path string, script RevolverScriptConfig) error {
+	return runCommandSet(ctx, env, nil, path, script)
+}
+
+// RunCommandSetWithListeners is RunCommandSet that hands the listeners to the run command.
+func RunCommandSetWithListeners(listeners []InheritedListener) func(context.Context, []string, string, RevolverScriptConfig) error {
+	return func(ctx context.Context, env []string, path string, script RevolverScriptConfig) error {
+		return runCommandSet(ctx, env, listeners, path, script)
+	}
+}
+
+func runCommandSet(ctx context.Context, env []string, listeners []InheritedListener, path string, script RevolverScriptConfig) error {
+	defer CloseInheritedListeners(listeners)
+
 	osEnv := os.Environ()
 	cmdEnv := make([]string, len(osEnv)+len(env))
 	copy(cmdEnv, osEnv)
@@ -71,7 +115,12 @@ func RunCommandSet(ctx context.Context, env []string, path string, script Revolv
 		return fmt.Errorf("failed to parse run commands: %w", err)
 	}
 
-	if err := runCommand(ctx, cmdEnv, path, runCommands[0], runCommands[1:]...); err != nil {
+	stopTimeout := script.StopTimeout
+	if stopTimeout <= 0 {
+		stopTimeout = DefaultStopTimeout
+	}
+
+	if err := runCommandWithListeners(ctx, cmdEnv, listeners, stopTimeout, path, runCommands[0], runCommands[1:]...); err != nil {
 		return fmt.Errorf("failed to run 'run' command: %w", err)
 	}
 
@@ -1,6 +1,11 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
 
 func TestParseCommand(t *testing.T) {
 	tests := []struct {
@@ -39,3 +44,50 @@ func TestParseCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestRunCommandStopTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh and SIGTERM")
+	}
+
+	const stopTimeout = 500 * time.Millisecond
+	tests := []struct {
+		name    string
+		command string
+		// killed is set when the command ignores SIGTERM and has to be killed after the timeout
+		killed bool
+	}{
+		{name: "stops on sigterm", command: `trap 'exit 0' TERM; sleep 10 >/dev/null 2>&1 & wait`},
+		{name: "ignores sigterm", command: `trap '' TERM; sleep 10 >/dev/null 2>&1 & wait`, killed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				runCommandWithListeners(ctx, nil, nil, stopTimeout, t.TempDir(), "sh", "-c", tt.command)
+			}()
+
+			// let the shell install its trap
+			time.Sleep(200 * time.Millisecond)
+			stopped := time.Now()
+			cancel()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("command was not stopped")
+			}
+
+			elapsed := time.Since(stopped)
+			if tt.killed && elapsed < stopTimeout {
+				t.Errorf("stopped after %s, want the stop timeout %s before the kill", elapsed, stopTimeout)
+			}
+			if !tt.killed && elapsed >= stopTimeout {
+				t.Errorf("stopped after %s, want before the stop timeout %s", elapsed, stopTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var SniPeekDoneError = errors.New("sni peek done")
+
+// peekConn feeds the handshake from a recording reader and refuses to write,
+// so a ClientHello can be parsed without answering it.
+type peekConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c peekConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (c peekConn) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+// PeekServerName reads the TLS ClientHello from conn and returns the requested server name
+// together with every byte consumed, which must be replayed to the destination.
+func PeekServerName(conn net.Conn, timeout time.Duration) (string, []byte, error) {
+	buf := &bytes.Buffer{}
+
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return "", nil, err
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	serverName := ""
+	found := false
+	err := tls.Server(peekConn{Conn: conn, reader: io.TeeReader(conn, buf)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			found = true
+			return nil, SniPeekDoneError
+		},
+	}).Handshake()
+	if !found {
+		return "", nil, err
+	}
+
+	return serverName, buf.Bytes(), nil
+}
+
+// route returns the proxy registered for serverName, trying an exact match first,
+// then a wildcard for the first label and last the "*" catch-all.
+func (trp *TcpReverseProxy) route(serverName string) *TcpReverseProxy {
+	serverName = strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if target, ok := trp.config.SniRoutes[serverName]; ok {
+		return target
+	}
+
+	if _, rest, ok := strings.Cut(serverName, "."); ok {
+		if target, ok := trp.config.SniRoutes["*."+rest]; ok {
+			return target
+		}
+	}
+
+	return trp.config.SniRoutes["*"]
+}
+
+func (trp *TcpReverseProxy) handleSniConn(ctx context.Context, conn net.Conn) {
+	if conn == nil {
+		log.Error().Msg("connection is nil")
+		return
+	}
+	remoteIp := conn.RemoteAddr()
+	remoteIpValue := remoteIp.String()
+
+	serverName, hello, err := PeekServerName(conn, 5*time.Second)
+	if err != nil {
+		conn.Close()
+		log.Error().Err(err).Str("remote_ip", remoteIpValue).Msg("failed to read client hello")
+		return
+	}
+
+	target := trp.route(serverName)
+	if target == nil {
+		conn.Close()
+		log.Error().Str("remote_ip", remoteIpValue).Str("server_name", serverName).Msg("no route found")
+		return
+	}
+
+	latestName, dest := target.pick()
+	if dest == nil {
+		conn.Close()
+		log.Error().Str("remote_ip", remoteIpValue).Str("server_name", serverName).Str("latest_name", latestName).Msg("no destination found")
+		return
+	}
+
+	dest.sessions.Add(1)
+	defer dest.sessions.Add(-1)
+
+	destinationConn, err := trp.dialDestination(dest, remoteIp)
+	if err != nil {
+		conn.Close()
+		log.Error().Err(err).Str("remote_ip", remoteIpValue).Str("server_name", serverName).Str("latest_name", latestName).Str("destination", dest.addr.String()).Msg("failed to dial remote")
+		return
+	}
+
+	if _, err := destinationConn.Write(hello); err != nil {
+		conn.Close()
+		destinationConn.Close()
+		log.Error().Err(err).Str("remote_ip", remoteIpValue).Str("server_name", serverName).Str("latest_name", latestName).Str("destination", dest.addr.String()).Msg("failed to replay client hello")
+		return
+	}
+
+	trp.pipe(ctx, conn, destinationConn, remoteIpValue, latestName, dest)
+}
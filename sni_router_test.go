@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPeekServerName(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverName string
+		tls        bool
+	}{
+		{name: "server name", serverName: "app.localhost", tls: true},
+		{name: "no server name", serverName: "", tls: true},
+		{name: "not tls", tls: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			go func() {
+				if tt.tls {
+					tls.Client(client, &tls.Config{ServerName: tt.serverName, InsecureSkipVerify: true}).Handshake()
+					return
+				}
+				client.Write([]byte("GET / HTTP/1.1\r\nHost: app.localhost\r\n\r\n"))
+			}()
+
+			serverName, hello, err := PeekServerName(server, 2*time.Second)
+			if !tt.tls {
+				if err == nil {
+					t.Errorf("PeekServerName() = %q, want an error for plaintext", serverName)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PeekServerName() error = %v", err)
+			}
+			if serverName != tt.serverName {
+				t.Errorf("PeekServerName() = %q, want %q", serverName, tt.serverName)
+			}
+			// the consumed bytes start with the handshake record, ready to be replayed
+			if len(hello) == 0 || hello[0] != 0x16 {
+				t.Errorf("hello = % x, want a tls handshake record", hello[:min(len(hello), 8)])
+			}
+		})
+	}
+}
+
+func TestSniRoute(t *testing.T) {
+	app, wildcard, fallback := &TcpReverseProxy{}, &TcpReverseProxy{}, &TcpReverseProxy{}
+	withFallback := &TcpReverseProxy{config: &TcpReverseProxyConfig{SniRoutes: map[string]*TcpReverseProxy{
+		"app.localhost": app,
+		"*.localhost":   wildcard,
+		"*":             fallback,
+	}}}
+	withoutFallback := &TcpReverseProxy{config: &TcpReverseProxyConfig{SniRoutes: map[string]*TcpReverseProxy{
+		"*.localhost": wildcard,
+	}}}
+
+	tests := []struct {
+		name       string
+		proxy      *TcpReverseProxy
+		serverName string
+		want       *TcpReverseProxy
+	}{
+		{name: "exact", proxy: withFallback, serverName: "app.localhost", want: app},
+		{name: "case and trailing dot", proxy: withFallback, serverName: "APP.localhost.", want: app},
+		{name: "wildcard", proxy: withFallback, serverName: "api.localhost", want: wildcard},
+		{name: "wildcard covers one label", proxy: withFallback, serverName: "v1.api.localhost", want: fallback},
+		{name: "fallback", proxy: withFallback, serverName: "example.com", want: fallback},
+		{name: "no server name", proxy: withFallback, serverName: "", want: fallback},
+		{name: "no fallback", proxy: withoutFallback, serverName: "example.com", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.proxy.route(tt.serverName); got != tt.want {
+				t.Errorf("route(%q) = %p, want %p", tt.serverName, got, tt.want)
+			}
+		})
+	}
+}
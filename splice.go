@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"net"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// copyConn copies src to dst like io.Copy, after unwrapping both ends down to their
+// sockets. Between two tcp or unix sockets linux then splices the bytes in the kernel
+// instead of copying them through userspace. TLS and idle timeout wrappers are kept,
+// as they have to see every byte.
+func copyConn(dst, src net.Conn) (int64, error) {
+	w := socketWriter(dst)
+	src = unwrapConn(src)
+
+	// bytes read past the PROXY header are still buffered, WriteTo flushes them before splicing
+	if pc, ok := src.(*proxyproto.Conn); ok {
+		return pc.WriteTo(w)
+	}
+
+	return io.Copy(w, src)
+}
+
+// unwrapConn looks through wrappers that only do bookkeeping on a connection.
+func unwrapConn(conn net.Conn) net.Conn {
+	for {
+		lc, ok := conn.(*limitedConn)
+		if !ok {
+			return conn
+		}
+		conn = lc.Conn
+	}
+}
+
+// socketWriter returns the socket under conn for writing.
+// A PROXY protocol connection only parses what it reads, its writes go straight to the socket.
+func socketWriter(conn net.Conn) io.Writer {
+	conn = unwrapConn(conn)
+	if pc, ok := conn.(*proxyproto.Conn); ok {
+		return unwrapConn(pc.Raw())
+	}
+
+	return conn
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"os"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -12,110 +16,564 @@ import (
 	"github.com/RussellLuo/timingwheel"
 	"github.com/pires/go-proxyproto"
 	"github.com/rs/zerolog/log"
+	"github.com/snowmerak/revolver/listener"
 )
 
+const DefaultDrainTimeout = 30 * time.Second
+
 type Destination struct {
-	addr     *net.TCPAddr
-	sessions atomic.Int64
+	session   string
+	service   string
+	addr      net.Addr
+	sessions  atomic.Int64
+	cleanup   func()
+	conns     map[io.Closer]struct{}
+	connsLock sync.Mutex
+	retiring  atomic.Pointer[timingwheel.Timer]
+	// onDialError is set on canary destinations to abort the canary on a failed dial
+	onDialError func(error)
+}
+
+// track registers connections of a session so they can be cut when draining times out.
+func (d *Destination) track(conns ...io.Closer) func() {
+	d.connsLock.Lock()
+	for _, c := range conns {
+		d.conns[c] = struct{}{}
+	}
+	d.connsLock.Unlock()
+
+	return func() {
+		d.connsLock.Lock()
+		for _, c := range conns {
+			delete(d.conns, c)
+		}
+		d.connsLock.Unlock()
+	}
+}
+
+// closeAll closes every tracked connection and returns how many sessions were cut.
+func (d *Destination) closeAll() int64 {
+	cut := d.sessions.Load()
+
+	d.connsLock.Lock()
+	defer d.connsLock.Unlock()
+	for c := range d.conns {
+		c.Close()
+	}
+
+	return cut
+}
+
+// dialFailed reports a failed dial to the canary controller, if the destination is a canary.
+func (d *Destination) dialFailed(err error) {
+	if d.onDialError != nil {
+		d.onDialError(err)
+	}
 }
 
 type TcpReverseProxyGcScheduler struct {
 }
 
 func (t TcpReverseProxyGcScheduler) Next(now time.Time) time.Time {
-	return now.Add(10 * time.Second)
+	return now.Add(1 * time.Second)
+}
+
+type TcpReverseProxyConfig struct {
+	Name         string
+	Mode         PortMode
+	Network      string
+	LiveReload   bool
+	TlsConfig    *tls.Config
+	SniRoutes    map[string]*TcpReverseProxy
+	DrainTimeout time.Duration
+	KeepPrevious time.Duration
+	IdleTimeout  time.Duration
+	ConnLimiter  *ConnLimiter
+}
+
+// WithProxyMode selects how the front listener is served.
+// An empty mode falls back to PortModeTcp.
+func WithProxyMode(mode PortMode) func(*TcpReverseProxyConfig) {
+	return func(c *TcpReverseProxyConfig) {
+		if mode != "" {
+			c.Mode = mode
+		}
+	}
+}
+
+// WithName sets the service name sent to destinations in the PROXY header.
+func WithName(name string) func(*TcpReverseProxyConfig) {
+	return func(c *TcpReverseProxyConfig) {
+		c.Name = name
+	}
+}
+
+// WithDrainTimeout limits how long a replaced destination may keep serving its open connections.
+// After the timeout they are closed and the destination's cleanup runs.
+func WithDrainTimeout(timeout time.Duration) func(*TcpReverseProxyConfig) {
+	return func(c *TcpReverseProxyConfig) {
+		if timeout > 0 {
+			c.DrainTimeout = timeout
+		}
+	}
+}
+
+// WithKeepPrevious keeps a replaced destination available for Rollback for the given period.
+// Its connections are still drained, but its cleanup is delayed until the period ends.
+func WithKeepPrevious(keep time.Duration) func(*TcpReverseProxyConfig) {
+	return func(c *TcpReverseProxyConfig) {
+		if keep > 0 {
+			c.KeepPrevious = keep
+		}
+	}
+}
+
+// WithIdleTimeout closes proxied connections that have not moved any bytes
+// in either direction for the timeout. Zero disables it.
+// The timeout has to watch every read, so connections are no longer spliced in the kernel.
+func WithIdleTimeout(timeout time.Duration) func(*TcpReverseProxyConfig) {
+	return func(c *TcpReverseProxyConfig) {
+		c.IdleTimeout = timeout
+	}
+}
+
+// WithConnLimiter caps the open client connections, shared with every proxy using the same limiter.
+func WithConnLimiter(limiter *ConnLimiter) func(*TcpReverseProxyConfig) {
+	return func(c *TcpReverseProxyConfig) {
+		c.ConnLimiter = limiter
+	}
+}
+
+// WithListenNetwork selects the network of the front listener, "tcp" or "unix".
+// For "unix" the proxy address is a socket path.
+func WithListenNetwork(network string) func(*TcpReverseProxyConfig) {
+	return func(c *TcpReverseProxyConfig) {
+		if network != "" {
+			c.Network = network
+		}
+	}
+}
+
+// WithLiveReload enables the browser live-reload script injection.
+// It only takes effect in PortModeHttp.
+func WithLiveReload(enabled bool) func(*TcpReverseProxyConfig) {
+	return func(c *TcpReverseProxyConfig) {
+		c.LiveReload = enabled
+	}
+}
+
+// WithTLS terminates TLS on the front listener.
+// Destinations keep receiving plaintext prefixed with the PROXY header.
+func WithTLS(cfg *tls.Config) func(*TcpReverseProxyConfig) {
+	return func(c *TcpReverseProxyConfig) {
+		c.TlsConfig = cfg
+	}
+}
+
+// WithSniRoutes maps TLS server names to the proxies whose current destination
+// should receive the connection. It only takes effect in PortModeSni.
+// A leading "*." matches any single label, e.g. "*.localhost", and "*" catches every other name.
+func WithSniRoutes(routes map[string]*TcpReverseProxy) func(*TcpReverseProxyConfig) {
+	return func(c *TcpReverseProxyConfig) {
+		c.SniRoutes = routes
+	}
 }
 
 type TcpReverseProxy struct {
 	listenAddr       string
+	listenNetAddr    net.Addr
 	destinations     map[string]*Destination
 	destinationsLock sync.RWMutex
 	currentLatest    string
+	canaryName       string
+	canaryWeight     int
 	timingWheel      *timingwheel.TimingWheel
+	config           *TcpReverseProxyConfig
+	liveReload       *LiveReload
+	cutConnections   atomic.Int64
 }
 
-func NewTcpReverseProxy(addr string) *TcpReverseProxy {
+func NewTcpReverseProxy(addr string, opt ...func(*TcpReverseProxyConfig)) *TcpReverseProxy {
+	cfg := &TcpReverseProxyConfig{
+		Mode:         PortModeTcp,
+		Network:      "tcp",
+		DrainTimeout: DefaultDrainTimeout,
+	}
+	for _, o := range opt {
+		o(cfg)
+	}
+
 	tw := timingwheel.NewTimingWheel(1*time.Second, 60)
+	tw.Start()
 
-	return &TcpReverseProxy{
+	trp := &TcpReverseProxy{
 		listenAddr:   addr,
 		destinations: make(map[string]*Destination),
 		timingWheel:  tw,
+		config:       cfg,
 	}
+
+	if cfg.Mode == PortModeHttp && cfg.LiveReload {
+		trp.liveReload = NewLiveReload()
+	}
+
+	return trp
 }
 
-func (trp *TcpReverseProxy) RenewDestination(name, addr string, cleanup func()) error {
-	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+// ResolveDestinationAddr resolves a backend address on the "tcp" or "unix" network.
+func ResolveDestinationAddr(network, addr string) (net.Addr, error) {
+	if network == "unix" {
+		return net.ResolveUnixAddr(network, addr)
+	}
+
+	return net.ResolveTCPAddr(network, addr)
+}
+
+// RenewDestination routes new connections to addr under the session name.
+// The previous destination keeps its open connections until they finish or the
+// drain timeout passes; cleanup runs once this destination is retired the same way.
+func (trp *TcpReverseProxy) RenewDestination(name, network, addr string, cleanup func()) error {
+	destAddr, err := ResolveDestinationAddr(network, addr)
 	if err != nil {
 		return err
 	}
 
 	trp.destinationsLock.Lock()
 	latestName := trp.currentLatest
+	previous := trp.destinations[latestName]
 	trp.currentLatest = name
 	trp.destinations[name] = &Destination{
-		addr: tcpAddr,
+		session: name,
+		service: trp.config.Name,
+		addr:    destAddr,
+		cleanup: cleanup,
+		conns:   make(map[io.Closer]struct{}),
 	}
 	trp.destinationsLock.Unlock()
 
-	go func() {
-		cancel := atomic.Pointer[func()]{}
-
-		tm := trp.timingWheel.ScheduleFunc(TcpReverseProxyGcScheduler{}, func() {
-			trp.destinationsLock.RLock()
-			v, ok := trp.destinations[latestName]
-			trp.destinationsLock.RUnlock()
-			if !ok && cancel.Load() != nil {
-				(*cancel.Load())()
+	if trp.liveReload != nil {
+		go trp.notifyLiveReload(name, destAddr)
+	}
+
+	if previous != nil {
+		trp.retireDestination(latestName, previous, trp.config.KeepPrevious)
+	}
+
+	return nil
+}
+
+var (
+	TcpReverseProxyDestinationNotFoundError = errors.New("destination not found")
+	TcpReverseProxyUnknownModeError         = errors.New("unknown proxy mode")
+)
+
+// HasDestination reports whether the named destination is still known, current or retiring.
+func (trp *TcpReverseProxy) HasDestination(name string) bool {
+	trp.destinationsLock.RLock()
+	defer trp.destinationsLock.RUnlock()
+
+	_, ok := trp.destinations[name]
+	return ok
+}
+
+// Rollback routes new connections back to a destination that is still kept after being replaced.
+// The destination it replaces is retired right away, without being kept.
+func (trp *TcpReverseProxy) Rollback(name string) error {
+	trp.destinationsLock.Lock()
+	dest, ok := trp.destinations[name]
+	if !ok {
+		trp.destinationsLock.Unlock()
+		return TcpReverseProxyDestinationNotFoundError
+	}
+	latestName := trp.currentLatest
+	previous := trp.destinations[latestName]
+	trp.currentLatest = name
+	trp.destinationsLock.Unlock()
+
+	if t := dest.retiring.Swap(nil); t != nil {
+		t.Stop()
+	}
+
+	if trp.liveReload != nil {
+		go trp.notifyLiveReload(name, dest.addr)
+	}
+
+	if previous != nil && latestName != name {
+		trp.retireDestination(latestName, previous, 0)
+	}
+
+	return nil
+}
+
+// retireDestination removes a replaced destination once it has no sessions left,
+// or cuts the remaining ones when the drain timeout passes. With keep set, the
+// destination and its cleanup are held back until keep has passed as well, so
+// a Rollback can still make it current again.
+func (trp *TcpReverseProxy) retireDestination(name string, dest *Destination, keep time.Duration) {
+	now := time.Now()
+	deadline := now.Add(trp.config.DrainTimeout)
+	keepUntil := now.Add(keep)
+	cut := atomic.Bool{}
+
+	timer := trp.timingWheel.ScheduleFunc(TcpReverseProxyGcScheduler{}, func() {
+		// rolled back to in the meantime
+		if latestName, _ := trp.current(); latestName == name {
+			return
+		}
+
+		sessions := dest.sessions.Load()
+		if sessions > 0 {
+			if time.Now().Before(deadline) {
+				log.Debug().Str("name", name).Int64("sessions", sessions).Msg("draining destination")
 				return
 			}
 
-			if v.sessions.Load() == 0 {
-				trp.destinationsLock.Lock()
-				delete(trp.destinations, latestName)
-				trp.destinationsLock.Unlock()
-				if cancel.Load() != nil {
-					(*cancel.Load())()
-				}
+			if cut.CompareAndSwap(false, true) {
+				closed := dest.closeAll()
+				trp.cutConnections.Add(closed)
+				log.Warn().Str("name", name).Int64("connections", closed).Dur("drain_timeout", trp.config.DrainTimeout).Msg("drain timeout exceeded, closed remaining connections")
 			}
-		})
+		}
 
-		cl := func() {
-			log.Info().Str("name", name).Msg("triggered cleanup")
-			tm.Stop()
-			cleanup()
+		if time.Now().Before(keepUntil) {
+			return
 		}
-		cancel.Store(&cl)
-	}()
 
-	return nil
+		if !trp.RemoveDestination(name) {
+			return
+		}
+
+		if t := dest.retiring.Swap(nil); t != nil {
+			t.Stop()
+		}
+
+		log.Info().Str("name", name).Msg("triggered cleanup")
+		if dest.cleanup != nil {
+			dest.cleanup()
+		}
+	})
+
+	if t := dest.retiring.Swap(timer); t != nil {
+		t.Stop()
+	}
+}
+
+// CutConnections returns how many connections drain timeouts have closed so far.
+func (trp *TcpReverseProxy) CutConnections() int64 {
+	return trp.cutConnections.Load()
 }
 
-func (trp *TcpReverseProxy) RemoveDestination(name string) {
+// RemoveDestination forgets a destination unless it is the current one.
+// It reports whether the destination was removed.
+func (trp *TcpReverseProxy) RemoveDestination(name string) bool {
 	trp.destinationsLock.Lock()
+	defer trp.destinationsLock.Unlock()
+
+	if trp.currentLatest == name {
+		return false
+	}
+
+	if _, ok := trp.destinations[name]; !ok {
+		return false
+	}
+
 	delete(trp.destinations, name)
+	return true
+}
+
+// closeDestinations forgets every destination of a stopped proxy and runs their cleanups,
+// so the sessions it held do not wait for it to drain them.
+func (trp *TcpReverseProxy) closeDestinations() {
+	trp.destinationsLock.Lock()
+	destinations := trp.destinations
+	trp.destinations = make(map[string]*Destination)
+	trp.currentLatest, trp.canaryName, trp.canaryWeight = "", "", 0
 	trp.destinationsLock.Unlock()
+
+	for name, dest := range destinations {
+		if t := dest.retiring.Swap(nil); t != nil {
+			t.Stop()
+		}
+
+		log.Info().Str("name", name).Msg("triggered cleanup")
+		if dest.cleanup != nil {
+			dest.cleanup()
+		}
+	}
+}
+
+// detachCurrent takes the current destination out of a proxy that is about to be replaced,
+// so stopping the proxy does not run its cleanup. It returns nil when there is none.
+func (trp *TcpReverseProxy) detachCurrent() *Destination {
+	trp.destinationsLock.Lock()
+	defer trp.destinationsLock.Unlock()
+
+	dest := trp.destinations[trp.currentLatest]
+	delete(trp.destinations, trp.currentLatest)
+	trp.currentLatest = ""
+
+	return dest
+}
+
+// adoptCurrent makes a destination detached from the proxy this one replaces current,
+// so the running session keeps being served until a restart renews it.
+func (trp *TcpReverseProxy) adoptCurrent(dest *Destination) {
+	trp.destinationsLock.Lock()
+	defer trp.destinationsLock.Unlock()
+
+	dest.service = trp.config.Name
+	trp.destinations[dest.session] = dest
+	trp.currentLatest = dest.session
+}
+
+// notifyLiveReload waits until the destination that just became current
+// accepts connections and then tells the connected browsers to reload.
+func (trp *TcpReverseProxy) notifyLiveReload(name string, addr net.Addr) {
+	deadline := time.Now().Add(LiveReloadWaitTimeout)
+	for time.Now().Before(deadline) {
+		trp.destinationsLock.RLock()
+		latestName := trp.currentLatest
+		trp.destinationsLock.RUnlock()
+		if latestName != name {
+			return
+		}
+
+		conn, err := net.DialTimeout(addr.Network(), addr.String(), time.Second)
+		if err == nil {
+			(&proxyproto.Header{Version: 2, Command: proxyproto.LOCAL}).WriteTo(conn)
+			conn.Close()
+			log.Debug().Str("name", name).Msg("triggered live reload")
+			trp.liveReload.Reload()
+			return
+		}
+
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	log.Warn().Str("name", name).Msg("destination did not become reachable, skipped live reload")
+}
+
+// current returns the name and the destination new connections are routed to.
+func (trp *TcpReverseProxy) current() (string, *Destination) {
+	trp.destinationsLock.RLock()
+	defer trp.destinationsLock.RUnlock()
+	return trp.currentLatest, trp.destinations[trp.currentLatest]
+}
+
+// remoteAddr parses the client address reported by net/http for the front listener's network.
+func (trp *TcpReverseProxy) remoteAddr(value string) (net.Addr, error) {
+	if trp.config.Network == "unix" {
+		return &net.UnixAddr{Name: value, Net: "unix"}, nil
+	}
+
+	return net.ResolveTCPAddr("tcp", value)
+}
+
+// headerTLVs describes the destination and the front listener to the backend,
+// see the TLVType constants in the listener package.
+func (trp *TcpReverseProxy) headerTLVs(dest *Destination) []proxyproto.TLV {
+	listenerPort := trp.listenNetAddr.String()
+	if addr, ok := trp.listenNetAddr.(*net.TCPAddr); ok {
+		listenerPort = strconv.Itoa(addr.Port)
+	}
+
+	return []proxyproto.TLV{
+		{Type: listener.TLVTypeSessionID, Value: []byte(dest.session)},
+		{Type: listener.TLVTypeServiceName, Value: []byte(dest.service)},
+		{Type: listener.TLVTypeListenerPort, Value: []byte(listenerPort)},
+	}
+}
+
+// dialDestination connects to the destination and writes the PROXY v2 header
+// describing the original client. Clients of a unix front listener are sent as a LOCAL
+// header, so the destination sees the proxy as the peer and still gets the TLVs.
+func (trp *TcpReverseProxy) dialDestination(dest *Destination, remote net.Addr) (net.Conn, error) {
+	destinationConn, err := net.Dial(dest.addr.Network(), dest.addr.String())
+	if err != nil {
+		dest.dialFailed(err)
+		return nil, err
+	}
+
+	listenAddr := trp.listenNetAddr
+	if src, ok := remote.(*net.TCPAddr); ok && src.IP.To4() != nil {
+		// a dual-stack wildcard listener reports [::] even for IPv4 clients
+		if dst, ok := listenAddr.(*net.TCPAddr); ok && dst.IP.To4() == nil && dst.IP.IsUnspecified() {
+			listenAddr = &net.TCPAddr{IP: net.IPv4zero, Port: dst.Port}
+		}
+	}
+
+	header := proxyproto.HeaderProxyFromAddrs(2, remote, listenAddr)
+	if _, ok := remote.(*net.TCPAddr); !ok {
+		// a unix client has no address to pass on, and the 216 bytes of unix addresses leave
+		// no room for the TLVs in the 256 bytes go-proxyproto buffers, so only the TLVs are sent
+		header = &proxyproto.Header{Version: 2, Command: proxyproto.LOCAL, TransportProtocol: proxyproto.UNSPEC}
+	}
+	if err := header.SetTLVs(trp.headerTLVs(dest)); err != nil {
+		destinationConn.Close()
+		return nil, fmt.Errorf("failed to set header tlvs: %w", err)
+	}
+
+	if _, err := header.WriteTo(destinationConn); err != nil {
+		destinationConn.Close()
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return destinationConn, nil
 }
 
 func (trp *TcpReverseProxy) Start(ctx context.Context) error {
-	l, err := net.Listen("tcp", trp.listenAddr)
+	switch trp.config.Mode {
+	case PortModeTcp, PortModeHttp, PortModeSni:
+	default:
+		return fmt.Errorf("%w: %s", TcpReverseProxyUnknownModeError, trp.config.Mode)
+	}
+
+	if trp.config.Network == "unix" {
+		if err := listener.RemoveStaleSocket(trp.listenAddr); err != nil {
+			return fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	l, err := net.Listen(trp.config.Network, trp.listenAddr)
 	if err != nil {
 		return err
 	}
 
 	context.AfterFunc(ctx, func() {
 		l.Close()
+		trp.closeDestinations()
+		trp.timingWheel.Stop()
 	})
 
-	listenIP, err := net.ResolveTCPAddr("tcp", trp.listenAddr)
-	if err != nil {
-		return err
+	trp.listenNetAddr = l.Addr()
+
+	if trp.config.Mode == PortModeHttp {
+		if trp.config.ConnLimiter != nil {
+			l = trp.config.ConnLimiter.Listener(ctx, l)
+		}
+		if trp.config.TlsConfig != nil {
+			l = tls.NewListener(l, trp.config.TlsConfig)
+		}
+		return trp.serveHttp(ctx, l)
 	}
 
-	pl := proxyproto.Listener{
+	var pl net.Listener = &proxyproto.Listener{
 		Listener:          l,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
+	// the limiter wraps the PROXY protocol connection instead of the socket,
+	// so the socket stays reachable for splicing, see copyConn
+	if trp.config.ConnLimiter != nil {
+		pl = trp.config.ConnLimiter.Listener(ctx, pl)
+	}
+	if trp.config.TlsConfig != nil && trp.config.Mode != PortModeSni {
+		pl = tls.NewListener(pl, trp.config.TlsConfig)
+	}
+
+	handle := trp.handleTcpConn
+	if trp.config.Mode == PortModeSni {
+		handle = trp.handleSniConn
+	}
 
 	failedCount := 0
 loop:
@@ -134,7 +592,8 @@ loop:
 			}
 			continue loop
 		}
-		log.Debug().Str("address", conn.RemoteAddr().String()).Msg("accepted connection")
+		// RemoteAddr would block on reading the PROXY header of the client
+		log.Debug().Msg("accepted connection")
 		failedCount = 0
 
 		context.AfterFunc(ctx, func() {
@@ -143,91 +602,79 @@ loop:
 			}
 		})
 
-		go func() {
-			if conn == nil {
-				log.Error().Msg("connection is nil")
-				return
-			}
-			remoteIpValue := conn.RemoteAddr().String()
-			remoteIp, err := net.ResolveTCPAddr("tcp", remoteIpValue)
-			if err != nil {
-				log.Error().Err(err).Str("remote_ip", remoteIpValue).Msg("failed to resolve remote ip")
-				return
-			}
+		go handle(ctx, conn)
+	}
+}
 
-			trp.destinationsLock.RLock()
-			latestName := trp.currentLatest
-			dest := trp.destinations[latestName]
-			trp.destinationsLock.RUnlock()
-			if dest == nil {
-				conn.Close()
-				log.Error().Str("remote_ip", remoteIpValue).Str("latest_name", latestName).Msg("no destination found")
-				return
-			}
+func (trp *TcpReverseProxy) handleTcpConn(ctx context.Context, conn net.Conn) {
+	if conn == nil {
+		log.Error().Msg("connection is nil")
+		return
+	}
+	remoteIp := conn.RemoteAddr()
+	remoteIpValue := remoteIp.String()
+
+	latestName, dest := trp.pick()
+	if dest == nil {
+		conn.Close()
+		log.Error().Str("remote_ip", remoteIpValue).Str("latest_name", latestName).Msg("no destination found")
+		return
+	}
 
-			dest.sessions.Add(1)
-			defer dest.sessions.Add(-1)
+	dest.sessions.Add(1)
+	defer dest.sessions.Add(-1)
 
-			destinationConn, err := net.DialTCP("tcp", nil, dest.addr)
-			if err != nil {
-				conn.Close()
-				log.Error().Err(err).Str("remote_ip", remoteIpValue).Str("latest_name", latestName).Str("destination", dest.addr.String()).Msg("failed to dial remote")
-				return
-			}
+	destinationConn, err := trp.dialDestination(dest, remoteIp)
+	if err != nil {
+		conn.Close()
+		log.Error().Err(err).Str("remote_ip", remoteIpValue).Str("latest_name", latestName).Str("destination", dest.addr.String()).Msg("failed to dial remote")
+		return
+	}
 
-			context.AfterFunc(ctx, func() {
-				destinationConn.Close()
-			})
+	trp.pipe(ctx, conn, destinationConn, remoteIpValue, latestName, dest)
+}
 
-			protocol := proxyproto.TCPv6
-			if remoteIp.IP.To4() != nil {
-				protocol = proxyproto.TCPv4
+// pipe copies data in both directions until both sides are done.
+// An EOF from one side is passed on as a half-close, so the other direction keeps
+// flowing; an error in either direction closes both connections.
+// It blocks so the caller can keep the destination's session count accurate.
+func (trp *TcpReverseProxy) pipe(ctx context.Context, conn net.Conn, destinationConn net.Conn, remoteIpValue string, latestName string, dest *Destination) {
+	stop := context.AfterFunc(ctx, func() {
+		destinationConn.Close()
+	})
+	defer stop()
+
+	untrack := dest.track(conn, destinationConn)
+	defer untrack()
+
+	client, backend := withIdleTimeout(trp.config.IdleTimeout, conn, destinationConn)
+
+	copyHalf := func(dst, src net.Conn, direction string) {
+		if _, err := copyConn(dst, src); err != nil {
+			destinationConn.Close()
+			conn.Close()
+			if errors.Is(err, net.ErrClosed) {
+				log.Debug().Err(err).Str("remote_ip", remoteIpValue).Str("latest_name", latestName).Str("destination", dest.addr.String()).Msg("failed to copy to " + direction)
+			} else if errors.Is(err, os.ErrDeadlineExceeded) {
+				log.Debug().Str("remote_ip", remoteIpValue).Str("latest_name", latestName).Str("destination", dest.addr.String()).Dur("idle_timeout", trp.config.IdleTimeout).Msg("closed idle connection")
+			} else {
+				log.Error().Err(err).Str("remote_ip", remoteIpValue).Str("latest_name", latestName).Str("destination", dest.addr.String()).Msg("failed to copy to " + direction)
 			}
+			return
+		}
 
-			header := &proxyproto.Header{
-				Version:           2,
-				Command:           proxyproto.PROXY,
-				TransportProtocol: protocol,
-				SourceAddr: &net.TCPAddr{
-					IP:   remoteIp.IP,
-					Port: remoteIp.Port,
-				},
-				DestinationAddr: &net.TCPAddr{
-					IP:   listenIP.IP,
-					Port: listenIP.Port,
-				},
-			}
+		closeWrite(dst)
+	}
 
-			if _, err := header.WriteTo(destinationConn); err != nil {
-				log.Error().Err(err).Str("remote_ip", remoteIpValue).Str("latest_name", latestName).Str("destination", dest.addr.String()).Msg("failed to write header")
-				return
-			}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		copyHalf(backend, client, "destination")
+	}()
 
-			go func() {
-				_, err := io.Copy(destinationConn, conn)
-				destinationConn.Close()
-				conn.Close()
-				if err != nil {
-					if errors.Is(err, net.ErrClosed) {
-						log.Debug().Err(err).Str("remote_ip", remoteIpValue).Str("latest_name", latestName).Str("destination", dest.addr.String()).Msg("failed to copy to destination")
-					} else {
-						log.Error().Err(err).Str("remote_ip", remoteIpValue).Str("latest_name", latestName).Str("destination", dest.addr.String()).Msg("failed to copy to destination")
-					}
-				}
-			}()
+	copyHalf(client, backend, "remote")
+	<-done
 
-			go func() {
-				_, err = io.Copy(conn, destinationConn)
-				destinationConn.Close()
-				conn.Close()
-				if err != nil {
-					if errors.Is(err, net.ErrClosed) {
-						log.Debug().Err(err).Str("remote_ip", remoteIpValue).Str("latest_name", latestName).Str("destination", dest.addr.String()).Msg("failed to copy to remote")
-					} else {
-						log.Error().Err(err).Str("remote_ip", remoteIpValue).Str("latest_name", latestName).Str("destination", dest.addr.String()).Msg("failed to copy to remote")
-					}
-				}
-			}()
-		}()
-	}
+	destinationConn.Close()
+	conn.Close()
 }
@@ -0,0 +1,617 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snowmerak/revolver/listener"
+)
+
+// startTestBackend serves every connection with handle behind a PROXY protocol listener.
+func startTestBackend(t testing.TB, handle func(net.Conn)) net.Addr {
+	t.Helper()
+
+	lis, err := listener.New("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listener.New() error = %v", err)
+	}
+	t.Cleanup(func() {
+		lis.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+
+	return lis.Addr()
+}
+
+// startTestProxy starts a tcp proxy in front of backend and returns its address.
+func startTestProxy(t testing.TB, backend net.Addr, opt ...func(*TcpReverseProxyConfig)) string {
+	t.Helper()
+
+	port, err := GetFreeTcpPort()
+	if err != nil {
+		t.Fatalf("GetFreeTcpPort() error = %v", err)
+	}
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	rp := NewTcpReverseProxy(addr, opt...)
+	if err := rp.RenewDestination("session", backend.Network(), backend.String(), nil); err != nil {
+		t.Fatalf("RenewDestination() error = %v", err)
+	}
+	go rp.Start(ctx)
+
+	for i := 0; i < 50; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return addr
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("proxy did not start on %s", addr)
+
+	return ""
+}
+
+func echo(conn net.Conn) {
+	io.Copy(conn, conn)
+}
+
+func TestTcpReverseProxyHalfClose(t *testing.T) {
+	backend := startTestBackend(t, func(conn net.Conn) {
+		data, _ := io.ReadAll(conn)
+		fmt.Fprintf(conn, "read %d bytes", len(data))
+	})
+	addr := startTestProxy(t, backend)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, "hello"); err != nil {
+		t.Fatalf("WriteString() error = %v", err)
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite() error = %v", err)
+	}
+
+	resp, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if want := "read 5 bytes"; string(resp) != want {
+		t.Errorf("response = %q, want %q", resp, want)
+	}
+}
+
+func TestTcpReverseProxyIdleTimeout(t *testing.T) {
+	const timeout = 300 * time.Millisecond
+
+	t.Run("idle", func(t *testing.T) {
+		addr := startTestProxy(t, startTestBackend(t, echo), WithIdleTimeout(timeout))
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		if _, err := io.WriteString(conn, "x"); err != nil {
+			t.Fatalf("WriteString() error = %v", err)
+		}
+
+		started := time.Now()
+		if _, err := io.ReadAll(conn); err != nil {
+			t.Fatalf("ReadAll() error = %v, want the proxy to close the connection", err)
+		}
+		if elapsed := time.Since(started); elapsed < timeout {
+			t.Errorf("closed after %v, want at least %v", elapsed, timeout)
+		}
+	})
+
+	t.Run("one direction active", func(t *testing.T) {
+		backend := startTestBackend(t, func(conn net.Conn) {
+			conn.Read(make([]byte, 1))
+			for i := 0; i < 5; i++ {
+				time.Sleep(timeout / 2)
+				io.WriteString(conn, "x")
+			}
+		})
+		addr := startTestProxy(t, backend, WithIdleTimeout(timeout))
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		if _, err := io.WriteString(conn, "x"); err != nil {
+			t.Fatalf("WriteString() error = %v", err)
+		}
+
+		resp, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+		if string(resp) != "xxxxx" {
+			t.Errorf("response = %q, want %q", resp, "xxxxx")
+		}
+	})
+}
+
+// roundTrip writes a byte and waits for the echo.
+func roundTrip(conn net.Conn, timeout time.Duration) error {
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := io.WriteString(conn, "x"); err != nil {
+		return err
+	}
+
+	_, err := io.ReadFull(conn, make([]byte, 1))
+	return err
+}
+
+// dialServed dials until a connection is served, as slots are released asynchronously.
+func dialServed(t *testing.T, addr string) net.Conn {
+	t.Helper()
+
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		err = roundTrip(conn, 5*time.Second)
+		if err == nil {
+			return conn
+		}
+		conn.Close()
+		if i == 50 {
+			t.Fatalf("roundTrip() error = %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestTcpReverseProxyConnLimit(t *testing.T) {
+	t.Run("reject", func(t *testing.T) {
+		addr := startTestProxy(t, startTestBackend(t, echo), WithConnLimiter(NewConnLimiter(1, ConnLimitPolicyReject)))
+
+		first := dialServed(t, addr)
+
+		second, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		defer second.Close()
+		if err := roundTrip(second, 5*time.Second); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("second connection error = %v, want it closed", err)
+		}
+
+		first.Close()
+		dialServed(t, addr).Close()
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		addr := startTestProxy(t, startTestBackend(t, echo), WithConnLimiter(NewConnLimiter(1, ConnLimitPolicyWait)))
+
+		first := dialServed(t, addr)
+
+		second, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		defer second.Close()
+		if _, err := io.WriteString(second, "x"); err != nil {
+			t.Fatalf("WriteString() error = %v", err)
+		}
+
+		second.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		if _, err := second.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("second connection read error = %v, want it to wait", err)
+		}
+
+		first.Close()
+
+		second.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(second, make([]byte, 1)); err != nil {
+			t.Errorf("second connection error = %v after a slot was released", err)
+		}
+	})
+}
+
+func TestTcpReverseProxySilentClient(t *testing.T) {
+	addr := startTestProxy(t, startTestBackend(t, echo))
+
+	// a client that never sends anything must not hold up the accept loop
+	silent, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer silent.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	if err := roundTrip(conn, time.Second); err != nil {
+		t.Errorf("roundTrip() error = %v", err)
+	}
+}
+
+func BenchmarkTcpReverseProxy(b *testing.B) {
+	benchmarks := []struct {
+		name  string
+		proxy bool
+		opt   []func(*TcpReverseProxyConfig)
+	}{
+		{name: "direct"},
+		{name: "splice", proxy: true},
+		{name: "splice_limited", proxy: true, opt: []func(*TcpReverseProxyConfig){WithConnLimiter(NewConnLimiter(16, ConnLimitPolicyWait))}},
+		// the idle timeout has to see every byte, which keeps the copy in userspace
+		{name: "userspace", proxy: true, opt: []func(*TcpReverseProxyConfig){WithIdleTimeout(time.Minute)}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			backend := startTestBackend(b, echo)
+			addr := backend.String()
+			if bm.proxy {
+				addr = startTestProxy(b, backend, bm.opt...)
+			}
+
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				b.Fatalf("Dial() error = %v", err)
+			}
+			defer conn.Close()
+
+			chunk := make([]byte, 256<<10)
+			b.SetBytes(int64(len(chunk)))
+			b.ResetTimer()
+
+			errc := make(chan error, 1)
+			go func() {
+				for i := 0; i < b.N; i++ {
+					if _, err := conn.Write(chunk); err != nil {
+						errc <- err
+						return
+					}
+				}
+				errc <- nil
+			}()
+
+			if _, err := io.CopyN(io.Discard, conn, int64(len(chunk))*int64(b.N)); err != nil {
+				b.Fatalf("CopyN() error = %v", err)
+			}
+			if err := <-errc; err != nil {
+				b.Fatalf("Write() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestTcpReverseProxyDrainTimeout(t *testing.T) {
+	const drainTimeout = time.Second
+
+	tests := []struct {
+		name    string
+		clients int
+		// hold keeps the clients open past the drain timeout
+		hold bool
+		// cut is the count of connections the drain timeout closed
+		cut int64
+	}{
+		{name: "clients finish in time", clients: 2},
+		{name: "clients outlive the timeout", clients: 3, hold: true, cut: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := startTestBackend(t, echo)
+			port, err := GetFreeTcpPort()
+			if err != nil {
+				t.Fatalf("GetFreeTcpPort() error = %v", err)
+			}
+			addr := "127.0.0.1:" + strconv.Itoa(port)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			cleanedUp := make(chan struct{})
+			rp := NewTcpReverseProxy(addr, WithDrainTimeout(drainTimeout))
+			if err := rp.RenewDestination("old", backend.Network(), backend.String(), func() { close(cleanedUp) }); err != nil {
+				t.Fatalf("RenewDestination() error = %v", err)
+			}
+			go rp.Start(ctx)
+
+			clients := make([]net.Conn, 0, tt.clients)
+			for i := 0; i < tt.clients; i++ {
+				conn, err := dialWhenListening("tcp", addr)
+				if err != nil {
+					t.Fatalf("Dial() error = %v", err)
+				}
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				// a round trip makes sure the session is counted before the swap
+				if _, err := io.WriteString(conn, "x"); err != nil {
+					t.Fatalf("WriteString() error = %v", err)
+				}
+				if _, err := io.ReadFull(conn, make([]byte, 1)); err != nil {
+					t.Fatalf("ReadFull() error = %v", err)
+				}
+				clients = append(clients, conn)
+			}
+
+			swapped := time.Now()
+			if err := rp.RenewDestination("new", backend.Network(), backend.String(), nil); err != nil {
+				t.Fatalf("RenewDestination() error = %v", err)
+			}
+			if !tt.hold {
+				for _, conn := range clients {
+					conn.Close()
+				}
+			}
+
+			select {
+			case <-cleanedUp:
+			case <-time.After(drainTimeout + 5*time.Second):
+				t.Fatalf("old destination was not cleaned up")
+			}
+
+			if tt.hold {
+				if elapsed := time.Since(swapped); elapsed < drainTimeout {
+					t.Errorf("cleaned up after %s, want the drain timeout %s first", elapsed, drainTimeout)
+				}
+				for i, conn := range clients {
+					if _, err := conn.Read(make([]byte, 1)); err == nil {
+						t.Errorf("client %d is still connected, want it cut", i)
+					}
+				}
+			}
+
+			if got := rp.CutConnections(); got != tt.cut {
+				t.Errorf("CutConnections() = %d, want %d", got, tt.cut)
+			}
+		})
+	}
+}
+
+// dialWhenListening dials addr, retrying while the proxy is starting.
+func dialWhenListening(network, addr string) (net.Conn, error) {
+	for i := 0; ; i++ {
+		conn, err := net.Dial(network, addr)
+		if err == nil || i == 50 {
+			return conn, err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestTcpReverseProxyUnix(t *testing.T) {
+	tests := []struct {
+		name    string
+		front   string
+		backend string
+	}{
+		{name: "unix front", front: "unix", backend: "tcp"},
+		{name: "unix backend", front: "tcp", backend: "unix"},
+		{name: "unix both", front: "unix", backend: "unix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// socket paths are limited to ~104 bytes, which a test temp dir can exceed
+			dir, err := os.MkdirTemp("", "revolver")
+			if err != nil {
+				t.Fatalf("MkdirTemp() error = %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			lis, err := listener.New("127.0.0.1:0")
+			if tt.backend == "unix" {
+				lis, err = listener.NewUnix(filepath.Join(dir, "backend.sock"))
+			}
+			if err != nil {
+				t.Fatalf("listen error = %v", err)
+			}
+			defer lis.Close()
+
+			go func() {
+				for {
+					conn, err := lis.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer conn.Close()
+						req, err := http.ReadRequest(bufio.NewReader(conn))
+						if err != nil {
+							return
+						}
+						body := "hello " + req.URL.Path
+						fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", len(body), body)
+					}()
+				}
+			}()
+
+			addr := "127.0.0.1:0"
+			if tt.front == "unix" {
+				addr = filepath.Join(dir, "front.sock")
+			} else {
+				port, err := GetFreeTcpPort()
+				if err != nil {
+					t.Fatalf("GetFreeTcpPort() error = %v", err)
+				}
+				addr = "127.0.0.1:" + strconv.Itoa(port)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			rp := NewTcpReverseProxy(addr, WithListenNetwork(tt.front))
+			if err := rp.RenewDestination("session", lis.Addr().Network(), lis.Addr().String(), nil); err != nil {
+				t.Fatalf("RenewDestination() error = %v", err)
+			}
+			go rp.Start(ctx)
+
+			conn, err := dialWhenListening(tt.front, addr)
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			if _, err := io.WriteString(conn, "GET /unix HTTP/1.1\r\nHost: revolver\r\n\r\n"); err != nil {
+				t.Fatalf("WriteString() error = %v", err)
+			}
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatalf("ReadResponse() error = %v", err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if want := "hello /unix"; string(body) != want {
+				t.Errorf("body = %q, want %q", body, want)
+			}
+		})
+	}
+}
+
+func TestTcpReverseProxyUnixNotSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "revolver")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "front.sock")
+	if err := os.WriteFile(path, []byte("keep"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := NewTcpReverseProxy(path, WithListenNetwork("unix")).Start(ctx); !errors.Is(err, listener.NotSocketError) {
+		t.Fatalf("Start() error = %v, want %v", err, listener.NotSocketError)
+	}
+
+	if data, err := os.ReadFile(path); err != nil || string(data) != "keep" {
+		t.Errorf("file = %q, %v, want it left alone", data, err)
+	}
+}
+
+func TestTcpReverseProxyHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+	}{
+		{name: "tcp", network: "tcp"},
+		// unix clients get a LOCAL header, the backend sees the proxy as the peer
+		{name: "unix", network: "unix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := startTestBackend(t, func(conn net.Conn) {
+				session, _ := listener.SessionID(conn)
+				service, _ := listener.ServiceName(conn)
+				port, _ := listener.ListenerPort(conn)
+				fmt.Fprintf(conn, "%s|%s|%s|%s", session, service, port, listener.ClientAddr(conn))
+			})
+
+			dir, err := os.MkdirTemp("", "revolver")
+			if err != nil {
+				t.Fatalf("MkdirTemp() error = %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			addr := filepath.Join(dir, "front.sock")
+			if tt.network == "tcp" {
+				port, err := GetFreeTcpPort()
+				if err != nil {
+					t.Fatalf("GetFreeTcpPort() error = %v", err)
+				}
+				addr = "127.0.0.1:" + strconv.Itoa(port)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			rp := NewTcpReverseProxy(addr, WithName("api"), WithListenNetwork(tt.network))
+			if err := rp.RenewDestination("0192f0c4-session", backend.Network(), backend.String(), nil); err != nil {
+				t.Fatalf("RenewDestination() error = %v", err)
+			}
+			go rp.Start(ctx)
+
+			conn, err := dialWhenListening(tt.network, addr)
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			// the proxy looks for a PROXY header of its own client before dialing
+			if _, err := io.WriteString(conn, "x"); err != nil {
+				t.Fatalf("WriteString() error = %v", err)
+			}
+
+			got, err := io.ReadAll(conn)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+
+			// the port of the proxy's own connection to the backend is unknown, only its ip is compared
+			want := "0192f0c4-session|api|" + addr + "|127.0.0.1:"
+			if tt.network == "tcp" {
+				_, port, _ := net.SplitHostPort(addr)
+				want = "0192f0c4-session|api|" + port + "|" + conn.LocalAddr().String()
+			}
+			match := string(got) == want
+			if tt.network == "unix" {
+				match = strings.HasPrefix(string(got), want)
+			}
+			if !match {
+				t.Errorf("backend got %q, want %q", got, want)
+			}
+		})
+	}
+}
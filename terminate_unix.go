@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// terminateProcess asks the process to shut down gracefully.
+func terminateProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,8 @@
+package main
+
+import "os"
+
+// terminateProcess kills the process, windows has no SIGTERM to send.
+func terminateProcess(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var TlsConfigMissingCertificateError = errors.New("tls requires cert and key paths or auto: true")
+
+const (
+	devCaCertFile   = "ca.pem"
+	devCaKeyFile    = "ca-key.pem"
+	devLeafCertFile = "cert.pem"
+	devLeafKeyFile  = "key.pem"
+)
+
+// DefaultDevCertificateHosts are always included in auto-generated leaf certificates.
+var DefaultDevCertificateHosts = []string{"localhost", "*.localhost", "127.0.0.1", "::1"}
+
+// LoadTlsConfig builds the server side tls.Config for a proxied port.
+func LoadTlsConfig(cfg *RevolverTlsConfig) (*tls.Config, error) {
+	var cert tls.Certificate
+	switch {
+	case cfg.Cert != "" && cfg.Key != "":
+		c, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key pair: %w", err)
+		}
+		cert = c
+	case cfg.Auto:
+		dir := cfg.Dir
+		if dir == "" {
+			cacheDir, err := os.UserCacheDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to find cache dir: %w", err)
+			}
+			dir = filepath.Join(cacheDir, "revolver", "tls")
+		}
+
+		c, err := LoadDevCertificate(dir, append(slices.Clone(DefaultDevCertificateHosts), cfg.Hosts...))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load dev certificate: %w", err)
+		}
+		cert = c
+	default:
+		return nil, TlsConfigMissingCertificateError
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// LoadDevCertificate returns a leaf certificate for hosts signed by a local CA kept in dir.
+// The CA is generated on first run and reused afterward so it only has to be trusted once.
+// The leaf is regenerated when it is missing, expiring, or does not cover every host.
+func LoadDevCertificate(dir string, hosts []string) (tls.Certificate, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	caCert, caKey, err := loadOrCreateDevCa(dir)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	certPath := filepath.Join(dir, devLeafCertFile)
+	keyPath := filepath.Join(dir, devLeafKeyFile)
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil && devCertificateCovers(cert.Leaf, caCert, hosts) {
+		return cert, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := newCertificateSerial()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"revolver development certificate"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(825 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if err := writePemFiles(certPath, der, keyPath, key); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	log.Info().Str("cert", certPath).Strs("hosts", hosts).Msg("generated dev certificate")
+
+	return tls.LoadX509KeyPair(certPath, keyPath)
+}
+
+func loadOrCreateDevCa(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPath := filepath.Join(dir, devCaCertFile)
+	keyPath := filepath.Join(dir, devCaKeyFile)
+
+	if pair, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		if key, ok := pair.PrivateKey.(*ecdsa.PrivateKey); ok && time.Now().Before(pair.Leaf.NotAfter) {
+			return pair.Leaf, key, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := newCertificateSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"revolver development CA"}, CommonName: "revolver development CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := writePemFiles(certPath, der, keyPath, key); err != nil {
+		return nil, nil, err
+	}
+
+	// a new CA invalidates every leaf signed by the previous one
+	os.Remove(filepath.Join(dir, devLeafCertFile))
+	os.Remove(filepath.Join(dir, devLeafKeyFile))
+
+	log.Warn().Str("ca", certPath).Msg("generated local CA, add it to your trust store to avoid browser warnings")
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+func devCertificateCovers(leaf, ca *x509.Certificate, hosts []string) bool {
+	if leaf == nil || time.Now().Add(24*time.Hour).After(leaf.NotAfter) {
+		return false
+	}
+
+	if leaf.CheckSignatureFrom(ca) != nil {
+		return false
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			if !slices.ContainsFunc(leaf.IPAddresses, ip.Equal) {
+				return false
+			}
+			continue
+		}
+		if !slices.Contains(leaf.DNSNames, host) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newCertificateSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func writePemFiles(certPath string, der []byte, keyPath string, key *ecdsa.PrivateKey) error {
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		return err
+	}
+
+	return nil
+}
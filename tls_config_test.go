@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadDevCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	// every step loads from the same dir, so the leaf of one step is what the next may reuse
+	tests := []struct {
+		name       string
+		hosts      []string
+		regenerate bool
+	}{
+		{name: "first run", hosts: []string{"localhost", "127.0.0.1"}, regenerate: true},
+		{name: "same hosts", hosts: []string{"localhost", "127.0.0.1"}},
+		{name: "fewer hosts", hosts: []string{"localhost"}},
+		{name: "new host", hosts: []string{"localhost", "127.0.0.1", "app.test"}, regenerate: true},
+	}
+
+	caPem, previous := []byte(nil), []byte(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := LoadDevCertificate(dir, tt.hosts)
+			if err != nil {
+				t.Fatalf("LoadDevCertificate() error = %v", err)
+			}
+
+			ca, err := os.ReadFile(filepath.Join(dir, devCaCertFile))
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if caPem == nil {
+				caPem = ca
+			} else if string(ca) != string(caPem) {
+				t.Errorf("CA was regenerated, want it reused")
+			}
+
+			if regenerated := string(cert.Certificate[0]) != string(previous); regenerated != tt.regenerate {
+				t.Errorf("leaf regenerated = %v, want %v", regenerated, tt.regenerate)
+			}
+			previous = cert.Certificate[0]
+
+			roots := x509.NewCertPool()
+			roots.AppendCertsFromPEM(caPem)
+			for _, host := range tt.hosts {
+				if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+					t.Errorf("Verify(%s) error = %v", host, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadTlsConfig(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadDevCertificate(dir, DefaultDevCertificateHosts); err != nil {
+		t.Fatalf("LoadDevCertificate() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  RevolverTlsConfig
+		err  error
+	}{
+		{name: "auto", cfg: RevolverTlsConfig{Auto: true, Dir: dir}},
+		{name: "key pair", cfg: RevolverTlsConfig{Cert: filepath.Join(dir, devLeafCertFile), Key: filepath.Join(dir, devLeafKeyFile)}},
+		{name: "cert without key", cfg: RevolverTlsConfig{Cert: filepath.Join(dir, devLeafCertFile)}, err: TlsConfigMissingCertificateError},
+		{name: "nothing", err: TlsConfigMissingCertificateError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadTlsConfig(&tt.cfg)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("LoadTlsConfig() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && len(cfg.Certificates) != 1 {
+				t.Errorf("certificates = %d, want 1", len(cfg.Certificates))
+			}
+		})
+	}
+}
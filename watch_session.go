@@ -0,0 +1,562 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+	"github.com/snowmerak/revolver/listener"
+)
+
+// keptSession is a started session of the application. A replaced one is kept so that a rollback
+// may return to it while its runnable is alive, and cancel stops it again.
+type keptSession struct {
+	id       string
+	runnable *Runnable
+	cancel   context.CancelFunc
+}
+
+// watchedProxy is a started proxy that a config reload may stop again.
+type watchedProxy struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// stop closes the proxy and waits until its listener is released.
+func (wp *watchedProxy) stop() {
+	wp.cancel()
+	<-wp.done
+}
+
+// watchSession runs the application of a watched config and the proxies in front of it.
+//
+// restartLock serializes restarts, config reloads and rollbacks, and is always taken before
+// stateLock. stateLock guards the session bookkeeping, which a running canary also updates
+// when it promotes its session. cfg is only replaced while holding both.
+type watchSession struct {
+	ctx      context.Context
+	filename string
+	options  []func(*ConfigLoadConfig)
+	watcher  *Watcher
+	limiter  *ConnLimiter
+
+	restartLock sync.Mutex
+	cfg         RevolverConfig
+	// rpm holds the proxies of the ports with a backend, proxies every started proxy by port name
+	rpm     map[string]*TcpReverseProxy
+	proxies map[string]*watchedProxy
+
+	stateLock    sync.Mutex
+	current      keptSession
+	kept         []keptSession
+	activeCanary *Canary
+}
+
+func newWatchSession(ctx context.Context, filename string, options []func(*ConfigLoadConfig), cfg RevolverConfig, watcher *Watcher) *watchSession {
+	return &watchSession{
+		ctx:      ctx,
+		filename: filename,
+		options:  options,
+		watcher:  watcher,
+		limiter:  NewConnLimiter(cfg.Limits.MaxConnections, cfg.Limits.Policy),
+		cfg:      cfg,
+		rpm:      map[string]*TcpReverseProxy{},
+		proxies:  map[string]*watchedProxy{},
+	}
+}
+
+// startPort starts the proxy of a port. Failing to listen is fatal for the ports revolver
+// starts with, for a port added by a config reload it is only logged.
+func (w *watchSession) startPort(cfg RevolverConfig, port RevolverPortConfig, fatal bool) error {
+	opts := []func(*TcpReverseProxyConfig){WithName(port.Name), WithProxyMode(port.Mode), WithIdleTimeout(cfg.Limits.IdleTimeout), WithConnLimiter(w.limiter)}
+	if port.HasBackend() {
+		opts = append(opts, WithLiveReload(port.LiveReload), WithDrainTimeout(cfg.DrainTimeout), WithKeepPrevious(max(cfg.Rollback.Keep, cfg.Rollback.Window)))
+		if port.Tls != nil {
+			tlsConfig, err := LoadTlsConfig(port.Tls)
+			if err != nil {
+				return fmt.Errorf("failed to load tls config for port %s: %w", port.Name, err)
+			}
+			opts = append(opts, WithTLS(tlsConfig))
+		}
+	} else {
+		if port.Tls != nil {
+			return fmt.Errorf("port %s: %w", port.Name, ConfigSniWithTlsError)
+		}
+
+		routes := make(map[string]*TcpReverseProxy, len(port.Routes))
+		for host, name := range port.Routes {
+			target, ok := w.rpm[name]
+			if !ok {
+				return fmt.Errorf("port %s routes %s to %s: %w", port.Name, host, name, ConfigUnknownRouteError)
+			}
+			if target.config.TlsConfig != nil {
+				return fmt.Errorf("port %s routes %s to %s: %w", port.Name, host, name, ConfigRouteToTlsError)
+			}
+			routes[strings.ToLower(host)] = target
+		}
+		opts = append(opts, WithSniRoutes(routes))
+	}
+
+	network, addr := port.ListenAddr()
+	opts = append(opts, WithListenNetwork(network))
+
+	rp := NewTcpReverseProxy(addr, opts...)
+	proxyCtx, proxyCancel := context.WithCancel(w.ctx)
+	wp := &watchedProxy{cancel: proxyCancel, done: make(chan struct{})}
+	go func() {
+		defer close(wp.done)
+		log.Info().Str("port", port.Name).Str("env", port.Env).Int("port", port.Port).Str("socket", port.Socket).Str("mode", string(port.Mode)).Bool("livereload", port.LiveReload).Bool("tls", port.Tls != nil).Msg("starting reverse proxy")
+		if err := rp.Start(proxyCtx); err != nil && proxyCtx.Err() == nil {
+			log.Error().Err(err).Str("port", port.Name).Msg("failed to start reverse proxy")
+			if fatal {
+				panic("occurred critical error!!")
+			}
+		}
+	}()
+
+	w.proxies[port.Name] = wp
+	if port.HasBackend() {
+		w.rpm[port.Name] = rp
+	}
+
+	return nil
+}
+
+// startPorts starts the backend ports before the sni ports routing to them.
+func (w *watchSession) startPorts(cfg RevolverConfig, ports []RevolverPortConfig, fatal bool) error {
+	for _, backend := range []bool{true, false} {
+		for _, port := range ports {
+			if port.HasBackend() != backend {
+				continue
+			}
+			if err := w.startPort(cfg, port, fatal); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *watchSession) stopPort(name string) {
+	if wp, ok := w.proxies[name]; ok {
+		wp.stop()
+		delete(w.proxies, name)
+		delete(w.rpm, name)
+	}
+}
+
+// keep remembers the replaced current session and forgets the ones whose runnable has stopped.
+// The caller holds stateLock.
+func (w *watchSession) keep() {
+	w.kept = slices.DeleteFunc(w.kept, func(k keptSession) bool {
+		return k.runnable != nil && !k.runnable.IsRunning()
+	})
+	if w.current.id == "" {
+		return
+	}
+
+	w.kept = append(w.kept, w.current)
+}
+
+// promote makes a started session current and watches it for an early crash.
+// The caller holds stateLock.
+func (w *watchSession) promote(session keptSession) {
+	w.keep()
+	w.current = session
+	w.watchCrash(session.id, session.runnable)
+}
+
+// Rollback routes every port back to the newest replaced session still alive, or aborts a
+// running canary. It does not wait for a restart in progress.
+func (w *watchSession) Rollback() (string, error) {
+	if !w.restartLock.TryLock() {
+		return "", CommandWatchBusyError
+	}
+	defer w.restartLock.Unlock()
+
+	return w.rollback("")
+}
+
+// rollback routes every port back to the newest replaced session still alive. With from set it only
+// does so while from is still current, otherwise it also aborts a running canary.
+// The caller holds restartLock.
+func (w *watchSession) rollback(from string) (string, error) {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	if from != "" && from != w.current.id {
+		return "", CommandWatchNotCurrentError
+	}
+
+	if from == "" && w.activeCanary != nil {
+		w.activeCanary.Abort(CanaryRolledBackError)
+		w.activeCanary = nil
+		return w.current.id, nil
+	}
+
+	if len(w.rpm) == 0 {
+		return "", CommandWatchNoPreviousError
+	}
+
+	// the newest replaced session that is still alive on every port
+	for len(w.kept) > 0 {
+		previous := w.kept[len(w.kept)-1]
+		w.kept = w.kept[:len(w.kept)-1]
+
+		if previous.runnable != nil && !previous.runnable.IsRunning() {
+			continue
+		}
+
+		available := true
+		for _, rp := range w.rpm {
+			if !rp.HasDestination(previous.id) {
+				available = false
+				break
+			}
+		}
+		if !available {
+			continue
+		}
+
+		for name, rp := range w.rpm {
+			if err := rp.Rollback(previous.id); err != nil {
+				return "", fmt.Errorf("failed to roll back port %s: %w", name, err)
+			}
+		}
+
+		log.Info().Str("from", w.current.id).Str("to", previous.id).Msg("rolled back to previous session")
+		w.current = previous
+
+		return w.current.id, nil
+	}
+
+	return "", CommandWatchNoPreviousError
+}
+
+// watchCrash rolls back when the runnable of a session that just became current
+// exits on its own within the rollback window. The caller holds stateLock.
+func (w *watchSession) watchCrash(id string, runnable *Runnable) {
+	window := w.cfg.Rollback.Window
+	if window <= 0 {
+		return
+	}
+
+	go func() {
+		timer := time.NewTimer(window)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			return
+		case <-runnable.Done():
+		}
+
+		exit, _ := runnable.Exit()
+		if exit.Canceled {
+			return
+		}
+
+		log.Warn().Err(exit.Err).Int("code", exit.Code).Str("session", id).Dur("window", window).Msg("runnable exited shortly after swap, rolling back")
+
+		// a restart in progress either replaces the session or leaves it current
+		w.restartLock.Lock()
+		defer w.restartLock.Unlock()
+
+		_, err := w.rollback(id)
+		switch {
+		case errors.Is(err, CommandWatchNotCurrentError):
+			log.Info().Str("session", id).Msg("crashed runnable was already replaced")
+		case err != nil:
+			log.Error().Err(err).Str("session", id).Msg("failed to roll back crashed runnable")
+		}
+	}()
+}
+
+// Restart starts a new session of the application and swaps the proxies over to it.
+func (w *watchSession) Restart(event *fsnotify.Event) {
+	switch event {
+	case nil:
+		log.Info().Msg("initializing")
+	default:
+		log.Info().Str("filename", event.Name).Any("op", event.Op).Msg("file changes detected")
+	}
+
+	w.restartLock.Lock()
+	defer w.restartLock.Unlock()
+
+	w.restart()
+}
+
+// restart does the work of Restart. The caller holds restartLock.
+func (w *watchSession) restart() {
+	log.Info().Msg("processing changes")
+
+	ctx, cancel := context.WithCancel(w.ctx)
+	cfg := w.cfg
+
+	w.stateLock.Lock()
+	previousCancel := w.current.cancel
+	w.stateLock.Unlock()
+
+	fileEnv, err := LoadEnvFiles(cfg.EnvFiles)
+	if err != nil {
+		cancel()
+		log.Error().Err(err).Msg("failed to load env files")
+		return
+	}
+
+	id, err := NewSession()
+	if err != nil {
+		cancel()
+		log.Error().Err(err).Msg("failed to create new session")
+		return
+	}
+
+	addrMap, listeners, err := GetBackendAddrs(id, cfg.Ports)
+	if err != nil {
+		cancel()
+		log.Error().Err(err).Msg("failed to get backend address")
+		return
+	}
+
+	context.AfterFunc(ctx, func() {
+		for _, addr := range addrMap {
+			if addr, ok := addr.(*net.UnixAddr); ok {
+				os.Remove(addr.Name)
+			}
+		}
+	})
+
+	portEnvMap := map[string]string{}
+	for _, port := range cfg.Ports {
+		if port.HasBackend() {
+			portEnvMap[port.Name] = port.Env
+		}
+	}
+
+	// port variables come last so an env file cannot override them
+	env := make([]string, 0, len(fileEnv)+len(addrMap)+1)
+	env = append(env, fileEnv...)
+	for name, addr := range addrMap {
+		env = append(env, portEnvMap[name]+"="+BackendEnvValue(addr))
+	}
+
+	notifySocket := (*NotifySocket)(nil)
+	if cfg.Ready.Notify {
+		notifySocket, err = NewNotifySocket(id)
+		if err != nil {
+			cancel()
+			CloseInheritedListeners(listeners)
+			log.Error().Err(err).Msg("failed to create notify socket")
+			return
+		}
+		context.AfterFunc(ctx, func() {
+			notifySocket.Close()
+		})
+		env = append(env, listener.NotifySocketEnv+"="+notifySocket.Path())
+	}
+
+	newRunnable := NewRunnable(cfg.ExecutablePackageFolder, cfg.Scripts)
+	if !newRunnable.Start(ctx, env, RunCommandSetWithListeners(listeners)) {
+		cancel()
+		CloseInheritedListeners(listeners)
+		log.Error().Msg("failed to start new runnable")
+		return
+	}
+
+	log.Info().Msg("started new runnable")
+
+	if notifySocket != nil {
+		timeout := cfg.Ready.WaitTimeout()
+		log.Info().Dur("timeout", timeout).Msg("waiting for new runnable to become ready")
+		if err := notifySocket.WaitReady(ctx, timeout, newRunnable.IsRunning); err != nil {
+			cancel()
+			log.Error().Err(err).Msg("new runnable failed to start, keeping previous runnable")
+			return
+		}
+	}
+
+	// the session is stopped once every proxy has drained it
+	remaining := atomic.Int64{}
+	remaining.Store(int64(len(w.rpm)))
+	cleanup := func() {
+		if remaining.Add(-1) == 0 {
+			log.Info().Str("session", id).Msg("stopping drained runnable")
+			cancel()
+		}
+	}
+
+	w.stateLock.Lock()
+	if w.activeCanary != nil {
+		w.activeCanary.Abort(CanarySupersededError)
+		w.activeCanary = nil
+	}
+	useCanary := len(cfg.Canary.Steps) > 0 && len(w.rpm) > 0 && w.current.id != ""
+	w.stateLock.Unlock()
+
+	if useCanary {
+		// without a notification the canary is only routed to once it accepts connections
+		if notifySocket == nil {
+			timeout := cfg.Ready.WaitTimeout()
+			log.Info().Dur("timeout", timeout).Msg("waiting for canary to accept connections")
+			if err := WaitListening(ctx, addrMap, timeout, newRunnable.IsRunning); err != nil {
+				cancel()
+				log.Error().Err(err).Msg("canary failed to start, keeping previous runnable")
+				return
+			}
+		}
+
+		canary := NewCanary(id, maps.Clone(w.rpm), cfg.Canary.Steps, cfg.Canary.Interval)
+		if err := canary.Start(addrMap, cleanup); err != nil {
+			canary.Abort(err)
+			cancel()
+			log.Error().Err(err).Msg("failed to start canary")
+			return
+		}
+
+		w.stateLock.Lock()
+		w.activeCanary = canary
+		w.stateLock.Unlock()
+
+		go func() {
+			err := canary.Run(ctx, newRunnable.IsRunning)
+
+			w.stateLock.Lock()
+			defer w.stateLock.Unlock()
+			if w.activeCanary == canary {
+				w.activeCanary = nil
+			}
+			// an aborted canary is stopped by cleanup once every proxy has drained it
+			if err != nil {
+				return
+			}
+			w.promote(keptSession{id: id, runnable: newRunnable, cancel: cancel})
+		}()
+		return
+	}
+
+	for name, rp := range w.rpm {
+		if err := rp.RenewDestination(id, addrMap[name].Network(), addrMap[name].String(), cleanup); err != nil {
+			cancel()
+			log.Error().Err(err).Msg("failed to renew destination")
+			return
+		}
+	}
+
+	w.stateLock.Lock()
+	w.promote(keptSession{id: id, runnable: newRunnable, cancel: cancel})
+	w.stateLock.Unlock()
+
+	if len(w.rpm) == 0 && previousCancel != nil {
+		previousCancel()
+		log.Info().Msg("stopped previous runnable")
+	}
+}
+
+// Reload applies the changes of the config file that can be applied while revolver runs
+// and restarts the application when they need it. A restart in progress finishes with the
+// running config first.
+func (w *watchSession) Reload(event *fsnotify.Event) {
+	reloaded, err := ReadConfig(w.filename, w.options...)
+	if err != nil {
+		PrintConfigErrors(os.Stderr, w.filename, err)
+	}
+	if IsConfigFatal(err) {
+		log.Error().Str("filename", w.filename).Msg("invalid config, keeping the running one")
+		return
+	}
+
+	w.restartLock.Lock()
+	defer w.restartLock.Unlock()
+
+	reloaded, diff := DiffConfig(w.cfg, reloaded)
+	if diff.Empty() {
+		return
+	}
+
+	log.Info().Str("filename", w.filename).Msg("reloading config")
+	if len(diff.Fixed) > 0 {
+		log.Warn().Strs("fields", diff.Fixed).Msg("config changes take effect after restarting revolver")
+	}
+
+	if diff.LogLevel {
+		SetLogLevel(reloaded.LogLevel)
+		log.Info().Str("log_level", string(reloaded.LogLevel)).Msg("changed log level")
+	}
+
+	w.stateLock.Lock()
+	if w.activeCanary != nil && (len(diff.AddedPorts) > 0 || len(diff.RemovedPorts) > 0) {
+		w.activeCanary.Abort(CanarySupersededError)
+		w.activeCanary = nil
+	}
+	w.cfg = reloaded
+	w.stateLock.Unlock()
+
+	// a changed port takes the running session over from the proxy it replaces,
+	// so the application stays reachable when the restart below fails
+	running := map[string]*Destination{}
+	for _, port := range diff.RemovedPorts {
+		replaced := slices.ContainsFunc(diff.AddedPorts, func(added RevolverPortConfig) bool {
+			return added.Name == port.Name && added.HasBackend()
+		})
+		if rp, ok := w.rpm[port.Name]; ok && replaced {
+			if dest := rp.detachCurrent(); dest != nil {
+				running[port.Name] = dest
+			}
+		}
+
+		log.Info().Str("port", port.Name).Msg("stopping reverse proxy")
+		w.stopPort(port.Name)
+	}
+	if err := w.startPorts(reloaded, diff.AddedPorts, false); err != nil {
+		log.Error().Err(err).Msg("failed to start reverse proxy")
+	}
+	for name, dest := range running {
+		if rp, ok := w.rpm[name]; ok {
+			rp.adoptCurrent(dest)
+			continue
+		}
+
+		// the replacing proxy did not start, so nothing routes to the session on this port anymore
+		if dest.cleanup != nil {
+			dest.cleanup()
+		}
+	}
+
+	if diff.Watcher {
+		w.watcher.SetExtensionFilter(reloaded.ObservingExts...)
+		if err := w.watcher.SetFiles(slices.Concat(reloaded.EnvFiles, reloaded.Files)...); err != nil {
+			log.Error().Err(err).Msg("failed to watch env files")
+		}
+	}
+
+	if diff.Restart {
+		if event != nil {
+			log.Info().Str("filename", event.Name).Any("op", event.Op).Msg("file changes detected")
+		}
+		w.restart()
+	}
+}
+
+// HandleEvent reloads the config when one of its files changed and restarts otherwise.
+// It runs on the watcher goroutine, the only one that replaces cfg.
+func (w *watchSession) HandleEvent(event *fsnotify.Event) {
+	if name, _ := filepath.Abs(event.Name); slices.Contains(w.cfg.Files, name) {
+		w.Reload(event)
+		return
+	}
+
+	w.Restart(event)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWatchSessionRollbackBusy(t *testing.T) {
+	w := newWatchSession(context.Background(), "", nil, RevolverConfig{}, nil)
+
+	w.restartLock.Lock()
+	if _, err := w.Rollback(); !errors.Is(err, CommandWatchBusyError) {
+		t.Errorf("Rollback() during a restart error = %v, want %v", err, CommandWatchBusyError)
+	}
+	w.restartLock.Unlock()
+
+	if _, err := w.Rollback(); !errors.Is(err, CommandWatchNoPreviousError) {
+		t.Errorf("Rollback() error = %v, want %v", err, CommandWatchNoPreviousError)
+	}
+}
+
+func TestWatchSessionReloadWaitsForRestart(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sleep")
+	}
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "revolver.yaml")
+	writeConfig := func(run string) {
+		config := "root: .\nexec: .\nscripts:\n  preload: \"true\"\n  run: " + run + "\n  cleanup: \"true\"\n"
+		if err := os.WriteFile(filename, []byte(config), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	writeConfig("sleep 10")
+	cfg, err := ReadConfig(filename)
+	if err != nil {
+		t.Fatalf("ReadConfig() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := newWatchSession(ctx, filename, nil, cfg, nil)
+	w.Restart(nil)
+	first, firstRunnable := w.current.id, w.current.runnable
+	if first == "" {
+		t.Fatalf("Restart() did not start a session")
+	}
+
+	writeConfig("sleep 20")
+	w.restartLock.Lock()
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		w.Reload(nil)
+	}()
+
+	select {
+	case <-reloaded:
+		t.Fatalf("Reload() returned while a restart was in progress")
+	case <-time.After(200 * time.Millisecond):
+	}
+	w.restartLock.Unlock()
+
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Reload() did not return after the restart")
+	}
+
+	w.stateLock.Lock()
+	current, run := w.current.id, w.cfg.Scripts.Run
+	w.stateLock.Unlock()
+	if current == first {
+		t.Errorf("session = %s after reload, want a new one", current)
+	}
+	if run != "sleep 20" {
+		t.Errorf("scripts.run = %q after reload, want %q", run, "sleep 20")
+	}
+
+	// without proxies to drain it the replaced session stops right away
+	select {
+	case <-firstRunnable.Done():
+	case <-time.After(5 * time.Second):
+		t.Errorf("replaced runnable was not stopped")
+	}
+
+	cancel()
+	<-w.current.runnable.Done()
+}
+
+func TestWatchSessionRollback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	rp := NewTcpReverseProxy("127.0.0.1:0", WithKeepPrevious(time.Minute))
+	for i, name := range []string{"a", "b", "c"} {
+		if err := rp.RenewDestination(name, "tcp", "127.0.0.1:"+strconv.Itoa(10001+i), nil); err != nil {
+			t.Fatalf("RenewDestination() error = %v", err)
+		}
+	}
+
+	exited := NewRunnable(t.TempDir(), RevolverScriptConfig{Preload: "true", Run: "true", CleanUp: "true"})
+	exited.Start(context.Background(), nil, RunCommandSet)
+	<-exited.Done()
+
+	session := func(id string, runnable *Runnable) (keptSession, context.Context) {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		return keptSession{id: id, runnable: runnable, cancel: cancel}, ctx
+	}
+	a, aCtx := session("a", nil)
+	b, _ := session("b", exited)
+	c, cCtx := session("c", nil)
+
+	w := newWatchSession(context.Background(), "", nil, RevolverConfig{}, nil)
+	w.rpm["api"] = rp
+	w.current = c
+	w.kept = []keptSession{a, b}
+
+	if _, err := w.rollback("b"); !errors.Is(err, CommandWatchNotCurrentError) {
+		t.Errorf("rollback(b) error = %v, want %v", err, CommandWatchNotCurrentError)
+	}
+
+	// b has exited, so the rollback skips it for a
+	got, err := w.Rollback()
+	if err != nil || got != "a" {
+		t.Fatalf("Rollback() = %s, %v, want a", got, err)
+	}
+	if name, _ := rp.current(); name != "a" {
+		t.Errorf("proxy routes to %s, want a", name)
+	}
+
+	// stopping the current session has to stop the one rolled back to
+	w.current.cancel()
+	if aCtx.Err() == nil || cCtx.Err() != nil {
+		t.Errorf("current cancel stopped a: %v, c: %v, want only a", aCtx.Err() != nil, cCtx.Err() != nil)
+	}
+
+	if _, err := w.Rollback(); !errors.Is(err, CommandWatchNoPreviousError) {
+		t.Errorf("Rollback() error = %v, want %v", err, CommandWatchNoPreviousError)
+	}
+}
+
+func TestWatchSessionReloadKeepsRunningSession(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	ports := make([]int, 2)
+	for i := range ports {
+		port, err := GetFreeTcpPort()
+		if err != nil {
+			t.Fatalf("GetFreeTcpPort() error = %v", err)
+		}
+		ports[i] = port
+	}
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "revolver.yaml")
+	writeConfig := func(preload string, port int) {
+		config := "root: .\nexec: .\nready:\n  notify: true\nscripts:\n  preload: \"" + preload + "\"\n  run: sleep 10\n  cleanup: \"true\"\n" +
+			"ports:\n  - name: api\n    port: " + strconv.Itoa(port) + "\n    env: PORT\n"
+		if err := os.WriteFile(filename, []byte(config), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	writeConfig("true", ports[0])
+	cfg, err := ReadConfig(filename)
+	if err != nil {
+		t.Fatalf("ReadConfig() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the running session is served by a test backend instead of a started application
+	w := newWatchSession(ctx, filename, nil, cfg, nil)
+	if err := w.startPorts(cfg, cfg.Ports, false); err != nil {
+		t.Fatalf("startPorts() error = %v", err)
+	}
+	backend := startTestBackend(t, echo)
+	sessionCtx, sessionCancel := context.WithCancel(context.Background())
+	defer sessionCancel()
+	if err := w.rpm["api"].RenewDestination("running", backend.Network(), backend.String(), sessionCancel); err != nil {
+		t.Fatalf("RenewDestination() error = %v", err)
+	}
+	w.current = keptSession{id: "running", cancel: sessionCancel}
+
+	// the port moves and the build breaks
+	writeConfig("false", ports[1])
+	w.Reload(nil)
+
+	if w.current.id != "running" {
+		t.Errorf("session = %s after a failed restart, want running", w.current.id)
+	}
+	if sessionCtx.Err() != nil {
+		t.Errorf("running session was stopped by the reload")
+	}
+
+	conn, err := dialWhenListening("tcp", "127.0.0.1:"+strconv.Itoa(ports[1]))
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	if err := roundTrip(conn, 5*time.Second); err != nil {
+		t.Errorf("roundTrip() error = %v, want the running session to answer on the moved port", err)
+	}
+}
+
+func TestWatchSessionCrashRollback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	tests := []struct {
+		name   string
+		window time.Duration
+		// cancel stops the new session instead of letting it crash
+		cancel bool
+		want   string
+	}{
+		{name: "crash in window", window: 5 * time.Second, want: "old"},
+		{name: "crash after window", window: 50 * time.Millisecond, want: "new"},
+		{name: "stopped in window", window: 5 * time.Second, cancel: true, want: "new"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := NewTcpReverseProxy("127.0.0.1:0", WithKeepPrevious(time.Minute))
+			for i, name := range []string{"old", "new"} {
+				if err := rp.RenewDestination(name, "tcp", "127.0.0.1:"+strconv.Itoa(10001+i), nil); err != nil {
+					t.Fatalf("RenewDestination() error = %v", err)
+				}
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			crashing := NewRunnable(t.TempDir(), RevolverScriptConfig{Preload: "true", Run: `sh -c "sleep 0.3; exit 1"`, CleanUp: "true"})
+			if !crashing.Start(ctx, nil, RunCommandSet) {
+				t.Fatalf("Start() = false")
+			}
+
+			w := newWatchSession(context.Background(), "", nil, RevolverConfig{Rollback: RevolverRollbackConfig{Window: tt.window}}, nil)
+			w.rpm["api"] = rp
+			w.current = keptSession{id: "old"}
+
+			w.stateLock.Lock()
+			w.promote(keptSession{id: "new", runnable: crashing, cancel: cancel})
+			w.stateLock.Unlock()
+
+			if tt.cancel {
+				cancel()
+			}
+			<-crashing.Done()
+
+			got := ""
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+				w.stateLock.Lock()
+				got = w.current.id
+				w.stateLock.Unlock()
+				if got == "old" {
+					break
+				}
+			}
+
+			if got != tt.want {
+				t.Errorf("current session = %s, want %s", got, tt.want)
+			}
+			if name, _ := rp.current(); name != tt.want {
+				t.Errorf("proxy routes to %s, want %s", name, tt.want)
+			}
+		})
+	}
+}
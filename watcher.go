@@ -24,6 +24,7 @@ type WatcherConfig struct {
 	Path                string
 	ExtensionFilter     []string
 	ExtensionFilterFunc func(string) bool
+	Files               []string
 }
 
 type Watcher struct {
@@ -33,6 +34,10 @@ type Watcher struct {
 	errHandlers       []*WatcherError
 	errHandlersLock   sync.RWMutex
 	config            *WatcherConfig
+	root              string
+	files             map[string]struct{}
+	dirs              map[string]struct{}
+	filterLock        sync.RWMutex
 }
 
 func WithPath(path string) func(*WatcherConfig) {
@@ -58,6 +63,14 @@ func WithExtensionFilterFunc(filter func(string) bool) func(*WatcherConfig) {
 	}
 }
 
+// WithFiles watches single files in addition to the path, whatever their extension.
+// A file may live outside the path, its directory is watched to catch editors that replace it.
+func WithFiles(files ...string) func(*WatcherConfig) {
+	return func(wc *WatcherConfig) {
+		wc.Files = files
+	}
+}
+
 func NewWatcher(ctx context.Context, opt ...func(*WatcherConfig)) (*Watcher, error) {
 	cfg := &WatcherConfig{}
 	for _, o := range opt {
@@ -73,14 +86,67 @@ func NewWatcher(ctx context.Context, opt ...func(*WatcherConfig)) (*Watcher, err
 		wc.Close()
 	})
 
+	root, err := filepath.Abs(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path: %w", err)
+	}
+
 	w := &Watcher{
 		watcher: wc,
 		config:  cfg,
+		root:    root,
 	}
 
 	return w, nil
 }
 
+// SetExtensionFilter replaces the extension filter of a running watcher.
+func (w *Watcher) SetExtensionFilter(extensions ...string) {
+	w.filterLock.Lock()
+	defer w.filterLock.Unlock()
+	w.config.ExtensionFilter = extensions
+}
+
+// SetFiles replaces the single files watched besides the path, see WithFiles.
+func (w *Watcher) SetFiles(files ...string) error {
+	w.filterLock.Lock()
+	defer w.filterLock.Unlock()
+
+	fileSet := make(map[string]struct{}, len(files))
+	dirSet := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		file, err := filepath.Abs(file)
+		if err != nil {
+			return fmt.Errorf("failed to resolve file: %w", err)
+		}
+		fileSet[file] = struct{}{}
+
+		if dir := filepath.Dir(file); dir != w.root {
+			dirSet[dir] = struct{}{}
+		}
+	}
+
+	for dir := range dirSet {
+		if _, ok := w.dirs[dir]; ok {
+			continue
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch file: %w", err)
+		}
+	}
+	for dir := range w.dirs {
+		if _, ok := dirSet[dir]; !ok {
+			w.watcher.Remove(dir)
+		}
+	}
+
+	w.config.Files = files
+	w.files = fileSet
+	w.dirs = dirSet
+
+	return nil
+}
+
 func (w *Watcher) AddEventHandler(id string, handler func(*fsnotify.Event)) {
 	w.eventHandlersLock.Lock()
 	defer w.eventHandlersLock.Unlock()
@@ -126,6 +192,10 @@ func (w *Watcher) Watch(ctx context.Context) error {
 		return fmt.Errorf("failed to watch path: %w", err)
 	}
 
+	if err := w.SetFiles(w.config.Files...); err != nil {
+		return err
+	}
+
 	done := ctx.Done()
 	closedChannelCount := 0
 
@@ -141,25 +211,8 @@ func (w *Watcher) Watch(ctx context.Context) error {
 					continue
 				}
 
-				ext := filepath.Ext(event.Name)
-				if len(w.config.ExtensionFilter) != 0 || w.config.ExtensionFilterFunc != nil {
-					found := false
-					for _, filter := range w.config.ExtensionFilter {
-						if strings.HasSuffix(ext, filter) {
-							found = true
-							break
-						}
-					}
-
-					if !found && w.config.ExtensionFilterFunc != nil {
-						if w.config.ExtensionFilterFunc(ext) {
-							found = true
-						}
-					}
-
-					if !found {
-						continue
-					}
+				if !w.match(event.Name) {
+					continue
 				}
 
 				w.eventHandlersLock.RLock()
@@ -189,3 +242,32 @@ func (w *Watcher) Watch(ctx context.Context) error {
 
 	return nil
 }
+
+// match reports whether an event on name passes the filters.
+func (w *Watcher) match(name string) bool {
+	w.filterLock.RLock()
+	defer w.filterLock.RUnlock()
+
+	name, _ = filepath.Abs(name)
+	if _, ok := w.files[name]; ok {
+		return true
+	}
+
+	// a directory watched for one of the files
+	if filepath.Dir(name) != w.root {
+		return false
+	}
+
+	if len(w.config.ExtensionFilter) == 0 && w.config.ExtensionFilterFunc == nil {
+		return true
+	}
+
+	ext := filepath.Ext(name)
+	for _, filter := range w.config.ExtensionFilter {
+		if strings.HasSuffix(ext, filter) {
+			return true
+		}
+	}
+
+	return w.config.ExtensionFilterFunc != nil && w.config.ExtensionFilterFunc(ext)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestWatcherFiles(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	envFile := filepath.Join(outside, ".env")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, err := NewWatcher(ctx, WithPath(root), WithExtensionFilter(".go"), WithFiles(envFile))
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+
+	events := make(chan string, 16)
+	w.AddEventHandler("test", func(event *fsnotify.Event) {
+		events <- filepath.Base(event.Name)
+	})
+	if err := w.Watch(ctx); err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+
+	for _, file := range []string{
+		filepath.Join(root, "notes.txt"),
+		filepath.Join(outside, "other.env"),
+		envFile,
+		filepath.Join(root, "main.go"),
+	} {
+		if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	seen := map[string]bool{}
+	timeout := time.After(2 * time.Second)
+	for !seen[".env"] || !seen["main.go"] {
+		select {
+		case name := <-events:
+			seen[name] = true
+		case <-timeout:
+			t.Fatalf("events = %v, want .env and main.go", seen)
+		}
+	}
+
+	if seen["notes.txt"] || seen["other.env"] {
+		t.Errorf("events = %v, want only .env and main.go", seen)
+	}
+}